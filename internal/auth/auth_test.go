@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"voucher-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateKey(t *testing.T) {
+	a, err := GenerateKey()
+	assert.NoError(t, err)
+	b, err := GenerateKey()
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(a, "vk_"))
+	assert.NotEqual(t, a, b)
+	assert.Len(t, DisplayPrefix(a), 11)
+	assert.Len(t, HashKey(a), 64)
+	assert.Equal(t, HashKey(a), HashKey(a))
+	assert.NotEqual(t, HashKey(a), HashKey(b))
+}
+
+func TestPrincipal_HasScope(t *testing.T) {
+	manager := &Principal{Scopes: []string{models.ScopeBrandManager, models.ScopeRead}}
+	assert.True(t, manager.HasScope(models.ScopeRead))
+	assert.True(t, manager.HasScope(models.ScopeBrandManager))
+	assert.False(t, manager.HasScope(models.ScopeRedeem))
+	assert.False(t, manager.HasScope(models.ScopeAdmin))
+
+	admin := &Principal{Scopes: []string{models.ScopeAdmin}}
+	assert.True(t, admin.HasScope(models.ScopeRedeem))
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	p := &Principal{Name: "pos"}
+	got, ok := FromContext(NewContext(context.Background(), p))
+	assert.True(t, ok)
+	assert.Same(t, p, got)
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is wrapped with the reason a bearer token was rejected
+var ErrInvalidToken = errors.New("invalid token")
+
+// clockSkew is how far apart our clock and the token issuer's may be
+const clockSkew = time.Minute
+
+// TokenVerifier checks the signed JWTs our consumer app sends on behalf of
+// customers. HS256 tokens are checked against a shared secret and RS256
+// tokens against public keys loaded from a JWKS file; an algorithm with no
+// key configured is rejected, as is any other algorithm.
+type TokenVerifier struct {
+	secret   []byte
+	keys     map[string]*rsa.PublicKey
+	issuer   string
+	audience string
+}
+
+// NewTokenVerifier returns a verifier that accepts no tokens until a secret
+// or keys are configured. A non-empty issuer or audience must match the
+// token's iss or aud claim.
+func NewTokenVerifier(issuer, audience string) *TokenVerifier {
+	return &TokenVerifier{keys: map[string]*rsa.PublicKey{}, issuer: issuer, audience: audience}
+}
+
+// SetSecret sets the shared secret HS256 tokens are signed with
+func (v *TokenVerifier) SetSecret(secret []byte) {
+	v.secret = secret
+}
+
+// jwk is the part of a JSON Web Key we use
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadJWKS adds the RSA signing keys in a JWKS file, keyed by their kid.
+// Keys of other types or uses are skipped.
+func (v *TokenVerifier) LoadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	loaded := 0
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != "RS256") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return fmt.Errorf("%s: key %q: bad modulus: %w", path, k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return fmt.Errorf("%s: key %q: bad exponent", path, k.Kid)
+		}
+		v.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		loaded++
+	}
+	if loaded == 0 {
+		return fmt.Errorf("%s: no RSA signing keys", path)
+	}
+	return nil
+}
+
+// Enabled reports whether any key has been configured
+func (v *TokenVerifier) Enabled() bool {
+	return len(v.secret) > 0 || len(v.keys) > 0
+}
+
+// CustomerClaims are the claims of a verified customer token. Subject is the
+// customer's ID.
+type CustomerClaims struct {
+	CustomerID int
+	ExpiresAt  time.Time
+}
+
+// Verify checks a token's signature and claims and returns the customer it
+// was issued to. Tokens must carry an expiry.
+func (v *TokenVerifier) Verify(token string, now time.Time) (*CustomerClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims struct {
+		Sub string          `json:"sub"`
+		Iss string          `json:"iss"`
+		Aud json.RawMessage `json:"aud"`
+		Exp *float64        `json:"exp"`
+		Nbf *float64        `json:"nbf"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if claims.Exp == nil {
+		return nil, fmt.Errorf("%w: no expiry", ErrInvalidToken)
+	}
+	expiresAt := time.Unix(int64(*claims.Exp), 0)
+	if !now.Before(expiresAt.Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if claims.Nbf != nil && now.Add(clockSkew).Before(time.Unix(int64(*claims.Nbf), 0)) {
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if v.issuer != "" && claims.Iss != v.issuer {
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	}
+	if v.audience != "" && !hasAudience(claims.Aud, v.audience) {
+		return nil, fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	}
+
+	customerID, err := strconv.Atoi(claims.Sub)
+	if err != nil || customerID <= 0 {
+		return nil, fmt.Errorf("%w: subject is not a customer ID", ErrInvalidToken)
+	}
+	return &CustomerClaims{CustomerID: customerID, ExpiresAt: expiresAt}, nil
+}
+
+// verifySignature checks sig over signed with the key for alg. Each
+// algorithm only ever uses its own kind of key, so an RSA public key can
+// never be mistaken for an HMAC secret.
+func (v *TokenVerifier) verifySignature(alg, kid, signed string, sig []byte) error {
+	switch alg {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return fmt.Errorf("%w: HS256 is not accepted", ErrInvalidToken)
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	case "RS256":
+		key, ok := v.keys[kid]
+		if !ok {
+			return fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+		}
+		sum := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: algorithm %q is not accepted", ErrInvalidToken, alg)
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// hasAudience reports whether an aud claim, a string or a list of them,
+// includes audience
+func hasAudience(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		for _, a := range list {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
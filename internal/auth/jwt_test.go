@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signToken builds a JWT with the given header and claims, signed with an
+// HMAC secret or an RSA private key
+func signToken(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(header) + "." + segment(claims)
+
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestTokenVerifier_Verify(t *testing.T) {
+	secret := []byte("test-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256"},
+		{
+			"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+	}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewTokenVerifier("https://app.example.com", "voucher-api")
+	assert.False(t, v.Enabled())
+	v.SetSecret(secret)
+	if !assert.NoError(t, v.LoadJWKS(path)) {
+		return
+	}
+	assert.True(t, v.Enabled())
+
+	now := time.Now()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "42",
+			"iss": "https://app.example.com",
+			"aud": []string{"voucher-api", "other"},
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	rs256 := map[string]interface{}{"alg": "RS256", "kid": "rsa-1"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "HS256", token: signToken(t, hs256, claims(nil), secret)},
+		{name: "RS256", token: signToken(t, rs256, claims(nil), rsaKey)},
+		{name: "single audience", token: signToken(t, hs256, claims(map[string]interface{}{"aud": "voucher-api"}), secret)},
+		{name: "within clock skew", token: signToken(t, hs256, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}), secret)},
+		{name: "wrong secret", token: signToken(t, hs256, claims(nil), []byte("other")), wantErr: true},
+		{name: "signed by another RSA key", token: signToken(t, rs256, claims(nil), otherKey), wantErr: true},
+		{name: "unknown kid", token: signToken(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-2"}, claims(nil), rsaKey), wantErr: true},
+		{name: "alg none", token: signToken(t, map[string]interface{}{"alg": "none"}, claims(nil), nil), wantErr: true},
+		{name: "expired", token: signToken(t, hs256, claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()}), secret), wantErr: true},
+		{name: "no expiry", token: signToken(t, hs256, claims(map[string]interface{}{"exp": nil}), secret), wantErr: true},
+		{name: "not valid yet", token: signToken(t, hs256, claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()}), secret), wantErr: true},
+		{name: "wrong issuer", token: signToken(t, hs256, claims(map[string]interface{}{"iss": "evil"}), secret), wantErr: true},
+		{name: "wrong audience", token: signToken(t, hs256, claims(map[string]interface{}{"aud": "other"}), secret), wantErr: true},
+		{name: "subject is not a customer", token: signToken(t, hs256, claims(map[string]interface{}{"sub": "admin"}), secret), wantErr: true},
+		{name: "malformed", token: "not.a-token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(tt.token, now)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidToken), "got %v", err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, 42, got.CustomerID)
+			}
+		})
+	}
+}
+
+func TestTokenVerifier_AlgorithmNotConfigured(t *testing.T) {
+	// Without a secret, HS256 tokens are refused rather than checked against
+	// an empty key
+	v := NewTokenVerifier("", "")
+	token := signToken(t, map[string]interface{}{"alg": "HS256"},
+		map[string]interface{}{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()}, []byte{})
+	_, err := v.Verify(token, time.Now())
+	assert.True(t, errors.Is(err, ErrInvalidToken), "got %v", err)
+}
+
+func TestTokenVerifier_LoadJWKS(t *testing.T) {
+	dir := t.TempDir()
+	noKeys := filepath.Join(dir, "empty.json")
+	os.WriteFile(noKeys, []byte(`{"keys":[{"kty":"EC","kid":"ec-1"}]}`), 0o600)
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`{"keys":`), 0o600)
+
+	v := NewTokenVerifier("", "")
+	assert.Error(t, v.LoadJWKS(filepath.Join(dir, "missing.json")))
+	assert.Error(t, v.LoadJWKS(noKeys))
+	assert.Error(t, v.LoadJWKS(invalid))
+	assert.False(t, v.Enabled())
+}
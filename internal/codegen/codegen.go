@@ -0,0 +1,177 @@
+// Package codegen generates random voucher codes that end in a check
+// character, so mistyped codes can be rejected without a database lookup.
+package codegen
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Ambiguous lists characters that are easily confused with one another when
+// read aloud or printed, such as 0 and O. They are rejected in either case.
+const Ambiguous = "01ILO"
+
+// DefaultAlphabet is the upper-case letters and digits without Ambiguous.
+// U is dropped as well to leave an even number of characters, which the
+// check character needs.
+const DefaultAlphabet = "23456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// DefaultLength is the number of random characters used when a pattern does
+// not set one
+const DefaultLength = 10
+
+// Bounds on a pattern
+const (
+	MinLength    = 4
+	MaxLength    = 32
+	MaxPrefixLen = 20
+)
+
+// SpaceFactor is how many times larger than the number of codes requested
+// the pattern's code space must be, so random draws rarely repeat
+const SpaceFactor = 10
+
+var (
+	ErrInvalidLength   = errors.New("code length must be between 4 and 32")
+	ErrInvalidAlphabet = errors.New("alphabet must have an even number of letters or digits, distinct ignoring case, and no ambiguous ones")
+	ErrInvalidPrefix   = errors.New("prefix must be at most 20 letters, digits or dashes")
+	ErrTooFewCodes     = errors.New("alphabet and length allow too few distinct codes for the count")
+)
+
+// Pattern describes the codes to generate: Prefix, then Length characters
+// drawn at random from Alphabet, then one check character from Alphabet. The
+// prefix is not covered by the check character.
+type Pattern struct {
+	Prefix   string
+	Length   int
+	Alphabet string
+}
+
+// WithDefaults fills in the length and alphabet when they are not set
+func (p Pattern) WithDefaults() Pattern {
+	if p.Length == 0 {
+		p.Length = DefaultLength
+	}
+	if p.Alphabet == "" {
+		p.Alphabet = DefaultAlphabet
+	}
+	return p
+}
+
+// Validate checks that codes can be generated from the pattern
+func (p Pattern) Validate() error {
+	if p.Length < MinLength || p.Length > MaxLength {
+		return ErrInvalidLength
+	}
+	if len(p.Prefix) > MaxPrefixLen {
+		return ErrInvalidPrefix
+	}
+	for _, c := range p.Prefix {
+		if !isAlphanumeric(c) && c != '-' {
+			return ErrInvalidPrefix
+		}
+	}
+	// Stored codes compare case-insensitively, so a letter may not appear
+	// in both cases
+	upper := strings.ToUpper(p.Alphabet)
+	if len(p.Alphabet) < 2 || len(p.Alphabet)%2 != 0 || strings.ContainsAny(upper, Ambiguous) {
+		return ErrInvalidAlphabet
+	}
+	for i, c := range p.Alphabet {
+		if !isAlphanumeric(c) || strings.IndexByte(upper, upper[i]) != i {
+			return ErrInvalidAlphabet
+		}
+	}
+	return nil
+}
+
+// ValidateCount checks that the pattern allows at least SpaceFactor times n
+// distinct codes. The pattern must be valid.
+func (p Pattern) ValidateCount(n int) error {
+	space := 1
+	for i := 0; i < p.Length && space < SpaceFactor*n; i++ {
+		space *= len(p.Alphabet)
+	}
+	if space < SpaceFactor*n {
+		return ErrTooFewCodes
+	}
+	return nil
+}
+
+// CodeLength is the length of every code the pattern generates
+func (p Pattern) CodeLength() int {
+	return len(p.Prefix) + p.Length + 1
+}
+
+// Generate returns a new random code. The pattern must be valid.
+func (p Pattern) Generate() (string, error) {
+	max := big.NewInt(int64(len(p.Alphabet)))
+	body := make([]byte, p.Length)
+	for i := range body {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		body[i] = p.Alphabet[n.Int64()]
+	}
+	return p.Prefix + string(body) + string(p.checkChar(string(body))), nil
+}
+
+// GenerateUnique returns n distinct random codes. It gives up with
+// ErrTooFewCodes after SpaceFactor times n draws, which a pattern that passes
+// ValidateCount for n practically never reaches.
+func (p Pattern) GenerateUnique(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for draws := 0; len(codes) < n; draws++ {
+		if draws == SpaceFactor*n {
+			return nil, ErrTooFewCodes
+		}
+		code, err := p.Generate()
+		if err != nil {
+			return nil, err
+		}
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// Check reports whether code fits the pattern and its check character is
+// correct
+func (p Pattern) Check(code string) bool {
+	if len(code) != p.CodeLength() || !strings.HasPrefix(code, p.Prefix) {
+		return false
+	}
+	body := code[len(p.Prefix) : len(code)-1]
+	for i := 0; i < len(body); i++ {
+		if strings.IndexByte(p.Alphabet, body[i]) < 0 {
+			return false
+		}
+	}
+	return p.checkChar(body) == code[len(code)-1]
+}
+
+// checkChar computes the Luhn mod N check character of body, which must only
+// hold characters from the alphabet. With an even-sized alphabet it catches
+// every single-character error and most transpositions of adjacent
+// characters.
+func (p Pattern) checkChar(body string) byte {
+	n := len(p.Alphabet)
+	factor, sum := 2, 0
+	for i := len(body) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(p.Alphabet, body[i])
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+	return p.Alphabet[(n-sum%n)%n]
+}
+
+func isAlphanumeric(c rune) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,120 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPattern_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern Pattern
+		wantErr error
+	}{
+		{
+			name:    "defaults",
+			pattern: Pattern{}.WithDefaults(),
+		},
+		{
+			name:    "prefix and custom alphabet",
+			pattern: Pattern{Prefix: "SUMMER-", Length: 8, Alphabet: "ABCDEF"},
+		},
+		{
+			name:    "too short",
+			pattern: Pattern{Length: 3, Alphabet: DefaultAlphabet},
+			wantErr: ErrInvalidLength,
+		},
+		{
+			name:    "ambiguous character",
+			pattern: Pattern{Length: 8, Alphabet: "ABCO"},
+			wantErr: ErrInvalidAlphabet,
+		},
+		{
+			name:    "lower-case ambiguous character",
+			pattern: Pattern{Length: 8, Alphabet: "abcl"},
+			wantErr: ErrInvalidAlphabet,
+		},
+		{
+			name:    "repeated character",
+			pattern: Pattern{Length: 8, Alphabet: "ABCA"},
+			wantErr: ErrInvalidAlphabet,
+		},
+		{
+			name:    "letter repeated in another case",
+			pattern: Pattern{Length: 8, Alphabet: "abAB"},
+			wantErr: ErrInvalidAlphabet,
+		},
+		{
+			name:    "lower-case alphabet",
+			pattern: Pattern{Length: 8, Alphabet: "abcd"},
+		},
+		{
+			name:    "odd number of characters",
+			pattern: Pattern{Length: 8, Alphabet: "ABCDE"},
+			wantErr: ErrInvalidAlphabet,
+		},
+		{
+			name:    "prefix with space",
+			pattern: Pattern{Prefix: "GIFT ", Length: 8, Alphabet: DefaultAlphabet},
+			wantErr: ErrInvalidPrefix,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantErr, tt.pattern.Validate())
+		})
+	}
+}
+
+func TestPattern_Generate(t *testing.T) {
+	p := Pattern{Prefix: "GIFT-", Length: 8}.WithDefaults()
+
+	codes, err := p.GenerateUnique(200)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 200)
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.False(t, seen[code], "duplicate code %s", code)
+		seen[code] = true
+		assert.Len(t, code, p.CodeLength())
+		assert.True(t, strings.HasPrefix(code, "GIFT-"))
+		assert.False(t, strings.ContainsAny(code[len("GIFT-"):], Ambiguous))
+		assert.True(t, p.Check(code), "check character of %s", code)
+	}
+}
+
+func TestPattern_ValidateCount(t *testing.T) {
+	small := Pattern{Length: 4, Alphabet: "AB"}
+	assert.NoError(t, small.Validate())
+	assert.NoError(t, small.ValidateCount(1))
+	assert.Equal(t, ErrTooFewCodes, small.ValidateCount(2))
+	assert.Equal(t, ErrTooFewCodes, small.ValidateCount(17))
+	assert.NoError(t, Pattern{}.WithDefaults().ValidateCount(1000))
+
+	// The redraw loop gives up instead of spinning when the space runs out
+	codes, err := small.GenerateUnique(17)
+	assert.Equal(t, ErrTooFewCodes, err)
+	assert.Nil(t, codes)
+}
+
+func TestPattern_CheckRejectsTypos(t *testing.T) {
+	p := Pattern{Length: 8}.WithDefaults()
+	code, err := p.Generate()
+	assert.NoError(t, err)
+
+	// Changing any single character must be caught
+	for i := 0; i < len(code); i++ {
+		for j := 0; j < len(p.Alphabet); j++ {
+			if p.Alphabet[j] == code[i] {
+				continue
+			}
+			typo := code[:i] + string(p.Alphabet[j]) + code[i+1:]
+			assert.False(t, p.Check(typo), "accepted %s for %s", typo, code)
+		}
+	}
+	assert.False(t, p.Check(code[:len(code)-1]))
+}
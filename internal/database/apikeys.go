@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"voucher-api/internal/models"
+)
+
+const apiKeyColumns = "id, tenant_id, name, key_prefix, scopes, revoked_at, created_at"
+
+// CreateAPIKey stores a new API key under the hash of the key itself and
+// fills in its ID and creation time
+func (d *DB) CreateAPIKey(key *models.APIKey, hash string) error {
+	result, err := d.db.Exec("INSERT INTO api_keys (tenant_id, name, key_prefix, key_hash, scopes) VALUES (?, ?, ?, ?, ?)",
+		nullInt(key.TenantID), key.Name, key.Prefix, hash, strings.Join(key.Scopes, ","))
+	if isMissingReference(err) {
+		return fmt.Errorf("%w: tenant %d does not exist", ErrInvalidReference, *key.TenantID)
+	}
+	if err != nil {
+		return translateError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return translateError(err)
+	}
+
+	stored, err := d.getAPIKey("id = ?", id)
+	if err != nil {
+		return notFound(err, "API key", int(id))
+	}
+	*key = *stored
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the unrevoked API key with the given hash
+func (d *DB) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	key, err := d.getAPIKey("key_hash = ? AND revoked_at IS NULL", hash)
+	return key, translateError(err)
+}
+
+// ListAPIKeys retrieves all API keys, including revoked ones
+func (d *DB) ListAPIKeys() ([]models.APIKey, error) {
+	rows, err := d.db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		keys = append(keys, *key)
+	}
+	return keys, translateError(rows.Err())
+}
+
+// RevokeAPIKey stops an API key from authenticating. Keys that do not exist
+// or are already revoked are reported as not found.
+func (d *DB) RevokeAPIKey(id int) error {
+	result, err := d.db.Exec("UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", id)
+	if err != nil {
+		return translateError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return translateError(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("API key %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// getAPIKey loads the API key matching a WHERE condition
+func (d *DB) getAPIKey(where string, args ...interface{}) (*models.APIKey, error) {
+	return scanAPIKey(d.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE "+where, args...))
+}
+
+// scanAPIKey reads a row selected with apiKeyColumns
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var tenantID sql.NullInt64
+	var scopes string
+	if err := row.Scan(&key.ID, &tenantID, &key.Name, &key.Prefix, &scopes, &key.RevokedAt, &key.CreatedAt); err != nil {
+		return nil, err
+	}
+	if tenantID.Valid {
+		id := int(tenantID.Int64)
+		key.TenantID = &id
+	}
+	key.Scopes = strings.Split(scopes, ",")
+	return &key, nil
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"database/sql"
+	"voucher-api/internal/models"
+)
+
+// brandColumns lists the columns scanBrand expects, in order
+const brandColumns = "id, tenant_id, name, description, archived_at, created_at, updated_at"
+
+// scanBrand reads a row selected with brandColumns
+func scanBrand(s scanner) (*models.Brand, error) {
+	var b models.Brand
+	var tenantID sql.NullInt64
+	if err := s.Scan(&b.ID, &tenantID, &b.Name, &b.Description, &b.ArchivedAt, &b.CreatedAt, &b.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if tenantID.Valid {
+		id := int(tenantID.Int64)
+		b.TenantID = &id
+	}
+	return &b, nil
+}
+
+// UpdateBrand saves a brand's name and description
+func (d *DB) UpdateBrand(brand *models.Brand) error {
+	scope, args := d.brandScope()
+	_, err := d.db.Exec("UPDATE brands SET name = ?, description = ? WHERE id = ?"+scope,
+		append([]interface{}{brand.Name, brand.Description, brand.ID}, args...)...)
+	return translateError(err)
+}
+
+// ArchiveBrand marks a brand archived and deactivates all of its active
+// vouchers in one transaction. It returns how many vouchers were deactivated.
+// Archiving an archived brand changes nothing.
+func (d *DB) ArchiveBrand(id int) (int, error) {
+	tx, err := d.BeginTx()
+	if err != nil {
+		return 0, translateError(err)
+	}
+	defer tx.Rollback()
+
+	archivedAt, err := d.lockBrand(tx, id)
+	if err != nil {
+		return 0, notFound(err, "brand", id)
+	}
+	if archivedAt.Valid {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec("UPDATE brands SET archived_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+		return 0, translateError(err)
+	}
+
+	// Only vouchers switched off here are flagged, so a restore does not
+	// reactivate vouchers that had been deactivated for other reasons
+	result, err := tx.Exec(`UPDATE vouchers SET is_active = false, archived_with_brand = true
+		WHERE brand_id = ? AND is_active = true AND deleted_at IS NULL`, id)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return int(n), translateError(tx.Commit())
+}
+
+// RestoreBrand clears a brand's archived state and reactivates the vouchers
+// that archiving it deactivated. It returns how many vouchers were
+// reactivated. Restoring a brand that is not archived changes nothing.
+func (d *DB) RestoreBrand(id int) (int, error) {
+	tx, err := d.BeginTx()
+	if err != nil {
+		return 0, translateError(err)
+	}
+	defer tx.Rollback()
+
+	archivedAt, err := d.lockBrand(tx, id)
+	if err != nil {
+		return 0, notFound(err, "brand", id)
+	}
+	if !archivedAt.Valid {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec("UPDATE brands SET archived_at = NULL WHERE id = ?", id); err != nil {
+		return 0, translateError(err)
+	}
+
+	result, err := tx.Exec(`UPDATE vouchers SET is_active = true, archived_with_brand = false
+		WHERE brand_id = ? AND archived_with_brand = true AND deleted_at IS NULL`, id)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return int(n), translateError(tx.Commit())
+}
+
+// lockBrand locks a brand row for the rest of the transaction and returns
+// when it was archived, if it was
+func (d *DB) lockBrand(tx *sql.Tx, id int) (sql.NullTime, error) {
+	scope, args := d.brandScope()
+	var archivedAt sql.NullTime
+	err := tx.QueryRow("SELECT archived_at FROM brands WHERE id = ?"+scope+" FOR UPDATE",
+		append([]interface{}{id}, args...)...).Scan(&archivedAt)
+	return archivedAt, err
+}
+
+// lockOpenBrand locks a brand row like lockBrand and returns
+// models.ErrBrandArchived if the brand is archived. Vouchers are created and
+// switched on under this lock, so they cannot slip past an ArchiveBrand that
+// runs at the same time.
+func (d *DB) lockOpenBrand(tx *sql.Tx, id int) error {
+	archivedAt, err := d.lockBrand(tx, id)
+	if err != nil {
+		return err
+	}
+	if archivedAt.Valid {
+		return models.ErrBrandArchived
+	}
+	return nil
+}
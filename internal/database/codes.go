@@ -0,0 +1,146 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"voucher-api/internal/models"
+)
+
+// AddVoucherCodes adds single-use codes to a voucher's pool in one
+// transaction and switches the voucher to handing out pool codes. If any code
+// is already reserved, in this pool or another or as a voucher's own code,
+// none are added.
+func (d *DB) AddVoucherCodes(voucherID int, codes []string) (*models.VoucherCodePool, error) {
+	tx, err := d.BeginTx()
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer tx.Rollback()
+
+	scope, scopeArgs := d.voucherScope()
+	var id int
+	err = tx.QueryRow("SELECT id FROM vouchers WHERE id = ? AND deleted_at IS NULL"+scope+" FOR UPDATE",
+		append([]interface{}{voucherID}, scopeArgs...)...).Scan(&id)
+	if err != nil {
+		return nil, notFound(err, "voucher", voucherID)
+	}
+
+	err = reserveCodes(tx, codes)
+	if isDuplicateEntry(err) {
+		return nil, fmt.Errorf("%w: one or more codes already exist", ErrConflict)
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("(?, ?), ", len(codes)), ", ")
+	args := make([]interface{}, 0, 2*len(codes))
+	for _, code := range codes {
+		args = append(args, voucherID, code)
+	}
+	_, err = tx.Exec("INSERT INTO voucher_codes (voucher_id, code) VALUES "+placeholders, args...)
+	if isDuplicateEntry(err) {
+		return nil, fmt.Errorf("%w: one or more codes already exist", ErrConflict)
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	if _, err := tx.Exec("UPDATE vouchers SET code_pool = true WHERE id = ?", voucherID); err != nil {
+		return nil, translateError(err)
+	}
+
+	pool := &models.VoucherCodePool{VoucherID: voucherID, Added: len(codes)}
+	err = tx.QueryRow("SELECT COUNT(*) FROM voucher_codes WHERE voucher_id = ? AND redemption_item_id IS NULL",
+		voucherID).Scan(&pool.Available)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return pool, translateError(tx.Commit())
+}
+
+// reserveCodes claims codes in reserved_codes, whose primary key keeps voucher
+// codes and pool codes unique between them. If any is taken, the insert fails
+// with a duplicate entry error and nothing is reserved.
+func reserveCodes(tx *sql.Tx, codes []string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("(?), ", len(codes)), ", ")
+	args := make([]interface{}, len(codes))
+	for i, code := range codes {
+		args[i] = code
+	}
+	_, err := tx.Exec("INSERT INTO reserved_codes (code) VALUES "+placeholders, args...)
+	return err
+}
+
+// assignCodes gives every item whose voucher has a code pool one unused code
+// from that pool per unit. The caller must hold the voucher row locks taken
+// by reserveVouchers so two redemptions cannot pick the same code. The codes
+// are read with a locking read, which sees the latest committed rows rather
+// than the transaction's snapshot, so codes assigned by a redemption that
+// committed after the snapshot was taken are not picked again.
+func assignCodes(tx *sql.Tx, items []models.RedemptionItem, pooled map[int]bool) error {
+	for i := range items {
+		item := &items[i]
+		if !pooled[item.VoucherID] {
+			continue
+		}
+
+		rows, err := tx.Query(`SELECT id, code FROM voucher_codes
+			WHERE voucher_id = ? AND redemption_item_id IS NULL ORDER BY id LIMIT ? FOR UPDATE`, item.VoucherID, item.Quantity)
+		if err != nil {
+			return err
+		}
+		var ids []interface{}
+		for rows.Next() {
+			var codeID int
+			var code string
+			if err := rows.Scan(&codeID, &code); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, codeID)
+			item.Codes = append(item.Codes, code)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(ids) < item.Quantity {
+			return fmt.Errorf("voucher %d: no unused codes left: %w", item.VoucherID, models.ErrOutOfStock)
+		}
+
+		inList := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+		args := append([]interface{}{item.ID}, ids...)
+		if _, err := tx.Exec(`UPDATE voucher_codes SET redemption_item_id = ?, assigned_at = CURRENT_TIMESTAMP
+			WHERE id IN (`+inList+`)`, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRedemptionCodes loads the pool codes assigned to the items of the given
+// redemptions, keyed by item ID
+func (d *DB) getRedemptionCodes(redemptionIDs []int) (map[int][]string, error) {
+	inList, args := intList(redemptionIDs)
+	rows, err := d.db.Query(`SELECT vc.redemption_item_id, vc.code FROM voucher_codes vc
+		JOIN redemption_items ri ON ri.id = vc.redemption_item_id
+		WHERE ri.redemption_id IN (`+inList+`) ORDER BY vc.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := map[int][]string{}
+	for rows.Next() {
+		var itemID int
+		var code string
+		if err := rows.Scan(&itemID, &code); err != nil {
+			return nil, err
+		}
+		codes[itemID] = append(codes[itemID], code)
+	}
+	return codes, rows.Err()
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"fmt"
+	"voucher-api/internal/models"
+)
+
+// CreateCustomer creates a new customer
+func (d *DB) CreateCustomer(customer *models.Customer) (int, error) {
+	query := `INSERT INTO customers (name, email, points_balance, is_active) VALUES (?, ?, ?, ?)`
+	result, err := d.db.Exec(query, customer.Name, customer.Email, customer.PointsBalance, customer.IsActive)
+	if isDuplicateEntry(err) {
+		return 0, fmt.Errorf("%w: %w", ErrConflict, models.ErrEmailTaken)
+	}
+	if err != nil {
+		return 0, translateError(err)
+	}
+	id, err := result.LastInsertId()
+	return int(id), translateError(err)
+}
+
+// GetCustomer retrieves a customer by ID
+func (d *DB) GetCustomer(id int) (*models.Customer, error) {
+	var c models.Customer
+	err := d.db.QueryRow(`SELECT id, name, email, points_balance, is_active, created_at, updated_at
+		FROM customers WHERE id = ?`, id).
+		Scan(&c.ID, &c.Name, &c.Email, &c.PointsBalance, &c.IsActive, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err, "customer", id)
+	}
+	return &c, nil
+}
+
+// ListCustomers retrieves all customers
+func (d *DB) ListCustomers() ([]models.Customer, error) {
+	rows, err := d.db.Query(`SELECT id, name, email, points_balance, is_active, created_at, updated_at
+		FROM customers`)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	customers := []models.Customer{}
+	for rows.Next() {
+		var c models.Customer
+		if err := rows.Scan(&c.ID, &c.Name, &c.Email, &c.PointsBalance, &c.IsActive,
+			&c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, translateError(err)
+		}
+		customers = append(customers, c)
+	}
+	return customers, translateError(rows.Err())
+}
+
+// UpdateCustomer updates a customer's name and email. The points balance is
+// only ever changed through the points ledger.
+func (d *DB) UpdateCustomer(customer *models.Customer) error {
+	_, err := d.db.Exec("UPDATE customers SET name = ?, email = ? WHERE id = ?",
+		customer.Name, customer.Email, customer.ID)
+	if isDuplicateEntry(err) {
+		return fmt.Errorf("%w: %w", ErrConflict, models.ErrEmailTaken)
+	}
+	return translateError(err)
+}
+
+// DeactivateCustomer marks a customer inactive so they can no longer redeem
+func (d *DB) DeactivateCustomer(id int) error {
+	_, err := d.db.Exec("UPDATE customers SET is_active = false WHERE id = ?", id)
+	return translateError(err)
+}
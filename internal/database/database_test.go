@@ -2,11 +2,15 @@ package database
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 	"voucher-api/internal/models"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,21 +41,21 @@ func TestGetVouchersByBrand(t *testing.T) {
 				validUntil := now.Add(24 * time.Hour)
 				rows := sqlmock.NewRows([]string{
 					"id", "brand_id", "code", "name", "description",
-					"points_cost", "is_active", "valid_until", "created_at", "updated_at",
+					"points_cost", "total_stock", "remaining_stock", "per_customer_limit", "limit_period", "code_pool", "is_active", "valid_from", "valid_until", "created_at", "updated_at",
 				}).AddRow(
 					1, 1, "CODE1", "Test Voucher 1", "Description 1",
-					100, true, validUntil, now, now,
+					100, nil, nil, nil, nil, false, true, nil, validUntil, now, now,
 				).AddRow(
 					2, 1, "CODE2", "Test Voucher 2", "Description 2",
-					200, true, validUntil, now, now,
+					200, 10, 4, nil, nil, false, true, nil, validUntil, now, now,
 				)
 
 				mock.ExpectQuery(`
-					SELECT id, brand_id, code, name, description, points_cost, 
-					       is_active, valid_until, created_at, updated_at
+					SELECT id, brand_id, code, name, description, points_cost, total_stock, 
+					       remaining_stock, per_customer_limit, limit_period, code_pool, is_active, valid_from, valid_until, created_at, updated_at
 					FROM vouchers 
-					WHERE brand_id = ?`).
-					WithArgs(1).
+					WHERE deleted_at IS NULL AND brand_id = ? ORDER BY id ASC LIMIT ?`).
+					WithArgs(1, 51).
 					WillReturnRows(rows)
 			},
 			want: []models.Voucher{
@@ -81,14 +85,14 @@ func TestGetVouchersByBrand(t *testing.T) {
 			brandID: 2,
 			mockSetup: func() {
 				mock.ExpectQuery(`
-					SELECT id, brand_id, code, name, description, points_cost, 
-					       is_active, valid_until, created_at, updated_at
+					SELECT id, brand_id, code, name, description, points_cost, total_stock, 
+					       remaining_stock, per_customer_limit, limit_period, code_pool, is_active, valid_from, valid_until, created_at, updated_at
 					FROM vouchers 
-					WHERE brand_id = ?`).
-					WithArgs(2).
+					WHERE deleted_at IS NULL AND brand_id = ? ORDER BY id ASC LIMIT ?`).
+					WithArgs(2, 51).
 					WillReturnRows(sqlmock.NewRows([]string{
 						"id", "brand_id", "code", "name", "description",
-						"points_cost", "is_active", "valid_until", "created_at", "updated_at",
+						"points_cost", "total_stock", "remaining_stock", "per_customer_limit", "limit_period", "code_pool", "is_active", "valid_from", "valid_until", "created_at", "updated_at",
 					}))
 			},
 			want:    []models.Voucher{},
@@ -99,11 +103,11 @@ func TestGetVouchersByBrand(t *testing.T) {
 			brandID: 3,
 			mockSetup: func() {
 				mock.ExpectQuery(`
-					SELECT id, brand_id, code, name, description, points_cost, 
-					       is_active, valid_until, created_at, updated_at
+					SELECT id, brand_id, code, name, description, points_cost, total_stock, 
+					       remaining_stock, per_customer_limit, limit_period, code_pool, is_active, valid_from, valid_until, created_at, updated_at
 					FROM vouchers 
-					WHERE brand_id = ?`).
-					WithArgs(3).
+					WHERE deleted_at IS NULL AND brand_id = ? ORDER BY id ASC LIMIT ?`).
+					WithArgs(3, 51).
 					WillReturnError(sql.ErrConnDone)
 			},
 			want:    nil,
@@ -118,7 +122,7 @@ func TestGetVouchersByBrand(t *testing.T) {
 			tt.mockSetup()
 
 			// Call the function being tested
-			got, err := dbInstance.GetVouchersByBrand(tt.brandID)
+			got, err := dbInstance.GetVouchersByBrand(tt.brandID, models.VoucherFilter{})
 
 			// Check error expectations
 			if tt.wantErr {
@@ -129,7 +133,9 @@ func TestGetVouchersByBrand(t *testing.T) {
 
 			// For successful cases, compare the results
 			// Note: We only compare specific fields since time fields will be different
-			for i, voucher := range got {
+			assert.Len(t, got.Data, len(tt.want))
+			assert.Empty(t, got.NextCursor)
+			for i, voucher := range got.Data {
 				assert.Equal(t, tt.want[i].ID, voucher.ID)
 				assert.Equal(t, tt.want[i].BrandID, voucher.BrandID)
 				assert.Equal(t, tt.want[i].Code, voucher.Code)
@@ -144,3 +150,2094 @@ func TestGetVouchersByBrand(t *testing.T) {
 		})
 	}
 }
+
+const lockCustomer = "SELECT points_balance, is_active FROM customers WHERE id = ? FOR UPDATE"
+
+var lockCustomerColumns = []string{"points_balance", "is_active"}
+
+const lockVoucher = `SELECT points_cost, remaining_stock, per_customer_limit, limit_period, code_pool,
+			is_active, valid_from, valid_until FROM vouchers WHERE id = ? FOR UPDATE`
+
+var lockVoucherColumns = []string{
+	"points_cost", "remaining_stock", "per_customer_limit", "limit_period", "code_pool", "is_active", "valid_from", "valid_until",
+}
+
+const nextPoolCodes = `SELECT id, code FROM voucher_codes
+			WHERE voucher_id = ? AND redemption_item_id IS NULL ORDER BY id LIMIT ? FOR UPDATE`
+
+const getItems = `SELECT ri.id, ri.redemption_id, ri.voucher_id, v.name, ri.quantity, ri.points_cost, ri.created_at
+		FROM redemption_items ri JOIN vouchers v ON v.id = ri.voucher_id
+		WHERE ri.redemption_id IN (?) ORDER BY ri.id`
+
+var itemColumns = []string{"id", "redemption_id", "voucher_id", "name", "quantity", "points_cost", "created_at"}
+
+const getItemCodes = `SELECT vc.redemption_item_id, vc.code FROM voucher_codes vc
+		JOIN redemption_items ri ON ri.id = vc.redemption_item_id
+		WHERE ri.redemption_id IN (?) ORDER BY vc.id`
+
+const redemptionTimes = "SELECT created_at, updated_at FROM redemptions WHERE id = ?"
+
+const insertItem = `INSERT INTO redemption_items (redemption_id, voucher_id, quantity, points_cost)
+			VALUES (?, ?, ?, ?)`
+
+const countRedeemed = `SELECT COALESCE(SUM(ri.quantity), 0) FROM redemption_items ri
+		JOIN redemptions r ON r.id = ri.redemption_id
+		WHERE r.customer_id = ? AND ri.voucher_id = ? AND r.status NOT IN (?, ?)`
+
+func TestCreateRedemption(t *testing.T) {
+	newRedemption := func() *models.Redemption {
+		return &models.Redemption{
+			CustomerID:      1,
+			TotalPointsCost: 400,
+			Status:          "pending",
+			Items: []models.RedemptionItem{
+				{VoucherID: 1, Quantity: 2, PointsCost: 100},
+				{VoucherID: 2, Quantity: 1, PointsCost: 200},
+			},
+		}
+	}
+
+	// Voucher 1 has limited stock and two units are taken, voucher 2 has a monthly limit of 3 per
+	// customer and hands out codes from a pool
+	expectStockReserved := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(lockVoucher).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(lockVoucherColumns).AddRow(100, 5, nil, nil, false, true, nil, nil))
+		mock.ExpectExec("UPDATE vouchers SET remaining_stock = remaining_stock - ? WHERE id = ?").
+			WithArgs(2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(lockVoucher).WithArgs(2).
+			WillReturnRows(sqlmock.NewRows(lockVoucherColumns).AddRow(200, nil, 3, "month", true, true, nil, nil))
+		mock.ExpectQuery(countRedeemed+" AND r.created_at >= ?").
+			WithArgs(1, 2, "cancelled", "failed", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	}
+
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		wantID    int
+		wantErr   error
+	}{
+		{
+			name: "commits redemption, items and deduction together",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(1000, true))
+				expectStockReserved(mock)
+				mock.ExpectExec("INSERT INTO redemptions (customer_id, total_points_cost, status) VALUES (?, ?, ?)").
+					WithArgs(1, 400, "pending").
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectQuery(redemptionTimes).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(time.Now(), time.Now()))
+				mock.ExpectExec(insertItem).
+					WithArgs(7, 1, 2, 100).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(insertItem).
+					WithArgs(7, 2, 1, 200).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectQuery(nextPoolCodes).WithArgs(2, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(31, "GIFT-0031"))
+				mock.ExpectExec(`UPDATE voucher_codes SET redemption_item_id = ?, assigned_at = CURRENT_TIMESTAMP
+			WHERE id IN (?)`).
+					WithArgs(2, 31).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE customers SET points_balance = points_balance - ?
+		WHERE id = ? AND points_balance >= ?`).
+					WithArgs(400, 1, 400).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT points_balance FROM customers WHERE id = ?").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"points_balance"}).AddRow(600))
+				mock.ExpectExec(insertLedgerEntry).
+					WithArgs(1, "redeem", -400, 600, "redemption", "7", "", nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			wantID: 7,
+		},
+		{
+			name: "balance re-checked under lock",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(350, true))
+				expectStockReserved(mock)
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrInsufficientPoints,
+		},
+		{
+			name: "customer deactivated after the handler checked",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(1000, false))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrCustomerInactive,
+		},
+		{
+			name: "out of stock",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(1000, true))
+				mock.ExpectQuery(lockVoucher).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockVoucherColumns).AddRow(100, 0, nil, nil, false, true, nil, nil))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrOutOfStock,
+		},
+		{
+			name: "deactivated after the handler checked",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(1000, true))
+				mock.ExpectQuery(lockVoucher).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockVoucherColumns).AddRow(100, 5, nil, nil, false, false, nil, nil))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrVoucherInactive,
+		},
+		{
+			name: "expired after the handler checked",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(1000, true))
+				mock.ExpectQuery(lockVoucher).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockVoucherColumns).
+						AddRow(100, 5, nil, nil, false, true, nil, time.Now().Add(-time.Minute)))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrExpiredVoucher,
+		},
+		{
+			name: "lifetime limit already used",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(1000, true))
+				mock.ExpectQuery(lockVoucher).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockVoucherColumns).AddRow(100, nil, 1, nil, false, true, nil, nil))
+				mock.ExpectQuery(countRedeemed).
+					WithArgs(1, 1, "cancelled", "failed").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrLimitReached,
+		},
+		{
+			name: "item insert failure rolls back",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(1000, true))
+				expectStockReserved(mock)
+				mock.ExpectExec("INSERT INTO redemptions (customer_id, total_points_cost, status) VALUES (?, ?, ?)").
+					WithArgs(1, 400, "pending").
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectQuery(redemptionTimes).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(time.Now(), time.Now()))
+				mock.ExpectExec(insertItem).
+					WithArgs(7, 1, 2, 100).
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			wantErr: sql.ErrConnDone,
+		},
+		{
+			name: "code pool exhausted",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(1000, true))
+				expectStockReserved(mock)
+				mock.ExpectExec("INSERT INTO redemptions (customer_id, total_points_cost, status) VALUES (?, ?, ?)").
+					WithArgs(1, 400, "pending").
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectQuery(redemptionTimes).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(time.Now(), time.Now()))
+				mock.ExpectExec(insertItem).
+					WithArgs(7, 1, 2, 100).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(insertItem).
+					WithArgs(7, 2, 1, 200).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectQuery(nextPoolCodes).WithArgs(2, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "code"}))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrOutOfStock,
+		},
+		{
+			// The balance read under the lock covered the basket, but the
+			// guarded decrement is the last word: when it changes no row
+			// nothing is committed
+			name: "guarded deduction changes no row",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(1000, true))
+				expectStockReserved(mock)
+				mock.ExpectExec("INSERT INTO redemptions (customer_id, total_points_cost, status) VALUES (?, ?, ?)").
+					WithArgs(1, 400, "pending").
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectQuery(redemptionTimes).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(time.Now(), time.Now()))
+				mock.ExpectExec(insertItem).
+					WithArgs(7, 1, 2, 100).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(insertItem).
+					WithArgs(7, 2, 1, 200).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectQuery(nextPoolCodes).WithArgs(2, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(31, "GIFT-0031"))
+				mock.ExpectExec(`UPDATE voucher_codes SET redemption_item_id = ?, assigned_at = CURRENT_TIMESTAMP
+			WHERE id IN (?)`).
+					WithArgs(2, 31).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE customers SET points_balance = points_balance - ?
+		WHERE id = ? AND points_balance >= ?`).
+					WithArgs(400, 1, 400).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT 1 FROM customers WHERE id = ?").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrInsufficientPoints,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			redemption := newRedemption()
+			id, err := NewDB(db).CreateRedemption(redemption)
+
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantID, id)
+				assert.Equal(t, tt.wantID, redemption.ID)
+				assert.Equal(t, tt.wantID, redemption.Items[1].RedemptionID)
+				assert.Empty(t, redemption.Items[0].Codes)
+				assert.Equal(t, []string{"GIFT-0031"}, redemption.Items[1].Codes)
+				assert.False(t, redemption.CreatedAt.IsZero())
+				assert.Equal(t, redemption.CreatedAt, redemption.Items[1].CreatedAt)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreateRedemptionFree(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	// A basket of zero-cost vouchers is stored without touching the balance
+	// or the ledger
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockCustomer).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(0, true))
+	mock.ExpectQuery(lockVoucher).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(lockVoucherColumns).AddRow(0, nil, nil, nil, false, true, nil, nil))
+	mock.ExpectExec("INSERT INTO redemptions (customer_id, total_points_cost, status) VALUES (?, ?, ?)").
+		WithArgs(1, 0, "pending").
+		WillReturnResult(sqlmock.NewResult(8, 1))
+	mock.ExpectQuery(redemptionTimes).WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(time.Now(), time.Now()))
+	mock.ExpectExec(insertItem).
+		WithArgs(8, 1, 1, 0).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectCommit()
+
+	id, err := NewDB(db).CreateRedemption(&models.Redemption{
+		CustomerID: 1,
+		Status:     "pending",
+		Items:      []models.RedemptionItem{{VoucherID: 1, Quantity: 1}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateRedemptionRepriced(t *testing.T) {
+	// The handler priced voucher 1 at 100, but it costs 150 by the time its
+	// row is locked
+	tests := []struct {
+		name    string
+		balance int
+		wantErr error
+	}{
+		{name: "charges the locked price", balance: 1000},
+		{name: "locked price exceeds the balance", balance: 250, wantErr: models.ErrInsufficientPoints},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(lockCustomer).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(tt.balance, true))
+			mock.ExpectQuery(lockVoucher).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(lockVoucherColumns).AddRow(150, nil, nil, nil, false, true, nil, nil))
+			if tt.wantErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectExec("INSERT INTO redemptions (customer_id, total_points_cost, status) VALUES (?, ?, ?)").
+					WithArgs(1, 300, "pending").
+					WillReturnResult(sqlmock.NewResult(9, 1))
+				mock.ExpectQuery(redemptionTimes).WithArgs(9).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(time.Now(), time.Now()))
+				mock.ExpectExec(insertItem).
+					WithArgs(9, 1, 2, 150).
+					WillReturnResult(sqlmock.NewResult(4, 1))
+				mock.ExpectExec(`UPDATE customers SET points_balance = points_balance - ?
+		WHERE id = ? AND points_balance >= ?`).
+					WithArgs(300, 1, 300).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT points_balance FROM customers WHERE id = ?").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"points_balance"}).AddRow(700))
+				mock.ExpectExec(insertLedgerEntry).
+					WithArgs(1, "redeem", -300, 700, "redemption", "9", "", nil).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+			}
+
+			redemption := &models.Redemption{
+				CustomerID:      1,
+				TotalPointsCost: 200,
+				Status:          "pending",
+				Items:           []models.RedemptionItem{{VoucherID: 1, Quantity: 2, PointsCost: 100}},
+			}
+			_, err = NewDB(db).CreateRedemption(redemption)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, 300, redemption.TotalPointsCost)
+				assert.Equal(t, 150, redemption.Items[0].PointsCost)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDeductPoints(t *testing.T) {
+	const deduct = `UPDATE customers SET points_balance = points_balance - ?
+		WHERE id = ? AND points_balance >= ?`
+
+	tests := []struct {
+		name    string
+		setup   func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "balance covers the deduction",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(deduct).WithArgs(400, 1, 400).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			// A concurrent redemption spent the points first, so the guarded
+			// update changes no row
+			name: "balance no longer covers the deduction",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(deduct).WithArgs(400, 1, 400).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT 1 FROM customers WHERE id = ?").WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+			},
+			wantErr: models.ErrInsufficientPoints,
+		},
+		{
+			name: "unknown customer",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(deduct).WithArgs(400, 1, 400).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT 1 FROM customers WHERE id = ?").WithArgs(1).WillReturnError(sql.ErrNoRows)
+			},
+			wantErr: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.setup(mock)
+
+			err = deductPoints(db, 1, 400)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetRedemption(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT id, customer_id, total_points_cost, status, created_at, updated_at 
+		FROM redemptions WHERE id = ?`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "customer_id", "total_points_cost", "status", "created_at", "updated_at",
+		}).AddRow(7, 1, 400, "pending", now, now))
+	mock.ExpectQuery(getItems).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(itemColumns).
+			AddRow(1, 7, 1, "Coffee", 2, 100, now).AddRow(2, 7, 2, "Gift card", 1, 200, now))
+	mock.ExpectQuery(getItemCodes).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"redemption_item_id", "code"}).AddRow(2, "GIFT-0031"))
+
+	got, err := NewDB(db).GetRedemption(7)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, got.TotalPointsCost)
+	if assert.Len(t, got.Items, 2) {
+		assert.Equal(t, 1, got.Items[0].VoucherID)
+		assert.Equal(t, "Coffee", got.Items[0].VoucherName)
+		assert.Equal(t, 2, got.Items[0].Quantity)
+		assert.Equal(t, 100, got.Items[0].PointsCost)
+		assert.Equal(t, 2, got.Items[1].VoucherID)
+		assert.Equal(t, 200, got.Items[1].PointsCost)
+		assert.Nil(t, got.Items[0].Codes)
+		assert.Equal(t, []string{"GIFT-0031"}, got.Items[1].Codes)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+const insertLedgerEntry = `INSERT INTO points_ledger
+		(customer_id, entry_type, amount, balance_after, reference_type, reference_id, description, idempotency_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+func TestRecordPointsEntry(t *testing.T) {
+	const deduct = `UPDATE customers SET points_balance = points_balance - ?
+		WHERE id = ? AND points_balance >= ?`
+
+	tests := []struct {
+		name      string
+		entry     models.PointsLedgerEntry
+		mockSetup func(mock sqlmock.Sqlmock)
+		wantErr   error
+	}{
+		{
+			name:  "credit",
+			entry: models.PointsLedgerEntry{CustomerID: 1, EntryType: models.LedgerAdjust, Amount: 50, Description: "goodwill"},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE customers SET points_balance = points_balance + ? WHERE id = ?").
+					WithArgs(50, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT points_balance FROM customers WHERE id = ?").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"points_balance"}).AddRow(150))
+				mock.ExpectExec(insertLedgerEntry).
+					WithArgs(1, "adjust", 50, 150, "", "", "goodwill", nil).
+					WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:  "debit covered by balance",
+			entry: models.PointsLedgerEntry{CustomerID: 1, EntryType: models.LedgerExpire, Amount: -100},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(deduct).WithArgs(100, 1, 100).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT points_balance FROM customers WHERE id = ?").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"points_balance"}).AddRow(0))
+				mock.ExpectExec(insertLedgerEntry).
+					WithArgs(1, "expire", -100, 0, "", "", "", nil).
+					WillReturnResult(sqlmock.NewResult(4, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:  "debit exceeds balance",
+			entry: models.PointsLedgerEntry{CustomerID: 1, EntryType: models.LedgerAdjust, Amount: -100},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(deduct).WithArgs(100, 1, 100).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT 1 FROM customers WHERE id = ?").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrInsufficientPoints,
+		},
+		{
+			name:  "debit for unknown customer",
+			entry: models.PointsLedgerEntry{CustomerID: 1, EntryType: models.LedgerAdjust, Amount: -100},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(deduct).WithArgs(100, 1, 100).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT 1 FROM customers WHERE id = ?").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"1"}))
+				mock.ExpectRollback()
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:      "unknown entry type",
+			entry:     models.PointsLedgerEntry{CustomerID: 1, EntryType: "bonus", Amount: 10},
+			mockSetup: func(mock sqlmock.Sqlmock) {},
+			wantErr:   models.ErrInvalidEntryType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			err = NewDB(db).RecordPointsEntry(&tt.entry)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotZero(t, tt.entry.ID)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestReconcileCustomerPoints(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT c.points_balance, COALESCE(SUM(l.amount), 0)
+		FROM customers c LEFT JOIN points_ledger l ON l.customer_id = c.id
+		WHERE c.id = ? GROUP BY c.id, c.points_balance`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"points_balance", "ledger"}).AddRow(500, 450))
+
+	rec, err := NewDB(db).ReconcileCustomerPoints(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 50, rec.Difference)
+	assert.False(t, rec.Balanced)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListCustomersEmpty(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT id, name, email, points_balance, is_active, created_at, updated_at
+		FROM customers`).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "name", "email", "points_balance", "is_active", "created_at", "updated_at",
+		}))
+
+	customers, err := NewDB(db).ListCustomers()
+	assert.NoError(t, err)
+	// An empty list must encode as [] rather than null
+	assert.NotNil(t, customers)
+	assert.Empty(t, customers)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateCustomerDuplicateEmail(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO customers (name, email, points_balance, is_active) VALUES (?, ?, ?, ?)`).
+		WithArgs("Jane Doe", "jane@example.com", 0, true).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'jane@example.com' for key 'email'"})
+
+	_, err = NewDB(db).CreateCustomer(&models.Customer{Name: "Jane Doe", Email: "jane@example.com", IsActive: true})
+	assert.True(t, errors.Is(err, models.ErrEmailTaken), "got %v", err)
+	assert.True(t, errors.Is(err, ErrConflict), "got %v", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreditPoints(t *testing.T) {
+	const selectByKey = `SELECT id, customer_id, entry_type, amount, balance_after,
+		reference_type, reference_id, description, idempotency_key, created_at
+		FROM points_ledger WHERE idempotency_key = ?`
+	ledgerRow := []string{
+		"id", "customer_id", "entry_type", "amount", "balance_after",
+		"reference_type", "reference_id", "description", "idempotency_key", "created_at",
+	}
+	credit := models.PointsCredit{
+		CustomerID:        1,
+		Points:            250,
+		Source:            "pos",
+		ExternalReference: "order-42",
+		IdempotencyKey:    "pos-order-42",
+	}
+
+	tests := []struct {
+		name          string
+		credit        models.PointsCredit
+		mockSetup     func(mock sqlmock.Sqlmock)
+		wantDuplicate bool
+		wantErr       error
+	}{
+		{
+			name:   "new credit",
+			credit: credit,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(100, true))
+				mock.ExpectQuery(selectByKey).
+					WithArgs("pos-order-42").
+					WillReturnRows(sqlmock.NewRows(ledgerRow))
+				mock.ExpectExec("UPDATE customers SET points_balance = points_balance + ? WHERE id = ?").
+					WithArgs(250, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT points_balance FROM customers WHERE id = ?").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"points_balance"}).AddRow(350))
+				mock.ExpectExec(insertLedgerEntry).
+					WithArgs(1, "earn", 250, 350, "pos", "order-42", "", "pos-order-42").
+					WillReturnResult(sqlmock.NewResult(9, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:   "retried credit is not applied twice",
+			credit: credit,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(350, true))
+				mock.ExpectQuery(selectByKey).
+					WithArgs("pos-order-42").
+					WillReturnRows(sqlmock.NewRows(ledgerRow).
+						AddRow(9, 1, "earn", 250, 350, "pos", "order-42", "", "pos-order-42", time.Now()))
+				mock.ExpectCommit()
+			},
+			wantDuplicate: true,
+		},
+		{
+			name: "key reused for a different credit",
+			credit: models.PointsCredit{
+				CustomerID: 1, Points: 999, Source: "pos", IdempotencyKey: "pos-order-42",
+			},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(350, true))
+				mock.ExpectQuery(selectByKey).
+					WithArgs("pos-order-42").
+					WillReturnRows(sqlmock.NewRows(ledgerRow).
+						AddRow(9, 1, "earn", 250, 350, "pos", "order-42", "", "pos-order-42", time.Now()))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrIdempotencyConflict,
+		},
+		{
+			name: "key reused with a different reference",
+			credit: models.PointsCredit{
+				CustomerID: 1, Points: 250, Source: "pos", ExternalReference: "order-43", IdempotencyKey: "pos-order-42",
+			},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(350, true))
+				mock.ExpectQuery(selectByKey).
+					WithArgs("pos-order-42").
+					WillReturnRows(sqlmock.NewRows(ledgerRow).
+						AddRow(9, 1, "earn", 250, 350, "pos", "order-42", "", "pos-order-42", time.Now()))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrIdempotencyConflict,
+		},
+		{
+			name: "key reused with a different source",
+			credit: models.PointsCredit{
+				CustomerID: 1, Points: 250, Source: "web", ExternalReference: "order-42", IdempotencyKey: "pos-order-42",
+			},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(350, true))
+				mock.ExpectQuery(selectByKey).
+					WithArgs("pos-order-42").
+					WillReturnRows(sqlmock.NewRows(ledgerRow).
+						AddRow(9, 1, "earn", 250, 350, "pos", "order-42", "", "pos-order-42", time.Now()))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrIdempotencyConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			results, err := NewDB(db).CreditPoints([]models.PointsCredit{tt.credit})
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else if assert.NoError(t, err) && assert.Len(t, results, 1) {
+				assert.Equal(t, tt.wantDuplicate, results[0].Duplicate)
+				assert.Equal(t, 9, results[0].Entry.ID)
+				assert.Equal(t, 350, results[0].Entry.BalanceAfter)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreditPointsLockOrder(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	credits := []models.PointsCredit{
+		{CustomerID: 2, Points: 100, Source: "pos", IdempotencyKey: "pos-a"},
+		{CustomerID: 1, Points: 200, Source: "pos", IdempotencyKey: "pos-b"},
+		{CustomerID: 2, Points: 300, Source: "pos", IdempotencyKey: "pos-c"},
+	}
+
+	// Customers are locked once each in ascending order, then credited in
+	// the order given
+	mock.ExpectBegin()
+	for _, id := range []int{1, 2} {
+		mock.ExpectQuery(lockCustomer).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(0, true))
+	}
+	balances := map[int]int{}
+	for i, credit := range credits {
+		balances[credit.CustomerID] += credit.Points
+		mock.ExpectQuery(`SELECT id, customer_id, entry_type, amount, balance_after,
+		reference_type, reference_id, description, idempotency_key, created_at
+		FROM points_ledger WHERE idempotency_key = ?`).
+			WithArgs(credit.IdempotencyKey).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec("UPDATE customers SET points_balance = points_balance + ? WHERE id = ?").
+			WithArgs(credit.Points, credit.CustomerID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT points_balance FROM customers WHERE id = ?").
+			WithArgs(credit.CustomerID).
+			WillReturnRows(sqlmock.NewRows([]string{"points_balance"}).AddRow(balances[credit.CustomerID]))
+		mock.ExpectExec(insertLedgerEntry).
+			WithArgs(credit.CustomerID, "earn", credit.Points, balances[credit.CustomerID], "pos", "", "", credit.IdempotencyKey).
+			WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	mock.ExpectCommit()
+
+	results, err := NewDB(db).CreditPoints(credits)
+	if assert.NoError(t, err) && assert.Len(t, results, 3) {
+		for i, result := range results {
+			assert.Equal(t, i+1, result.Entry.ID)
+			assert.Equal(t, credits[i].IdempotencyKey, result.Entry.IdempotencyKey)
+		}
+		assert.Equal(t, 400, results[2].Entry.BalanceAfter)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransitionRedemption(t *testing.T) {
+	const lockRedemption = "SELECT customer_id, total_points_cost, status FROM redemptions WHERE id = ? FOR UPDATE"
+	const releasedItems = `SELECT voucher_id, SUM(quantity) FROM redemption_items
+		WHERE redemption_id = ? GROUP BY voucher_id ORDER BY voucher_id`
+	const releaseStock = `UPDATE vouchers SET remaining_stock = remaining_stock + ?
+			WHERE id = ? AND remaining_stock IS NOT NULL`
+
+	tests := []struct {
+		name      string
+		status    string
+		mockSetup func(mock sqlmock.Sqlmock)
+		wantErr   error
+	}{
+		{
+			name:   "cancel returns stock and refunds points",
+			status: models.StatusCancelled,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				now := time.Now()
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockRedemption).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"customer_id", "total_points_cost", "status"}).
+						AddRow(1, 300, "pending"))
+				mock.ExpectQuery(lockCustomer).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(lockCustomerColumns).AddRow(700, true))
+				mock.ExpectExec("UPDATE redemptions SET status = ? WHERE id = ?").
+					WithArgs("cancelled", 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(releasedItems).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"voucher_id", "quantity"}).AddRow(2, 1).AddRow(5, 3))
+				mock.ExpectExec(releaseStock).
+					WithArgs(1, 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(releaseStock).
+					WithArgs(3, 5).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE customers SET points_balance = points_balance + ? WHERE id = ?").
+					WithArgs(300, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT points_balance FROM customers WHERE id = ?").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"points_balance"}).AddRow(1000))
+				mock.ExpectExec(insertLedgerEntry).
+					WithArgs(1, "refund", 300, 1000, "redemption", "7", "Redemption cancelled", nil).
+					WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT id, customer_id, total_points_cost, status, created_at, updated_at 
+		FROM redemptions WHERE id = ?`).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{
+						"id", "customer_id", "total_points_cost", "status", "created_at", "updated_at",
+					}).AddRow(7, 1, 300, "cancelled", now, now))
+				mock.ExpectQuery(getItems).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows(itemColumns))
+				mock.ExpectQuery(getItemCodes).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"redemption_item_id", "code"}))
+			},
+		},
+		{
+			name:   "cancelled redemption cannot complete",
+			status: models.StatusCompleted,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockRedemption).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"customer_id", "total_points_cost", "status"}).
+						AddRow(1, 300, "cancelled"))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrInvalidTransition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			got, err := NewDB(db).TransitionRedemption(7, tt.status)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.status, got.Status)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListCustomerRedemptions(t *testing.T) {
+	const listRedemptions = `SELECT id, customer_id, total_points_cost, status, created_at, updated_at
+		FROM redemptions WHERE customer_id = ?`
+	columns := []string{"id", "customer_id", "total_points_cost", "status", "created_at", "updated_at"}
+	now := time.Now()
+	from := now.AddDate(0, -1, 0)
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+	dbInstance := NewDB(db)
+
+	// Newest first by default, with the items of the whole page loaded at once
+	mock.ExpectQuery(listRedemptions+" AND status = ? AND created_at >= ? ORDER BY id DESC LIMIT ?").
+		WithArgs(1, "completed", from, 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(9, 1, 100, "completed", now, now).
+			AddRow(8, 1, 200, "completed", now, now).
+			AddRow(4, 1, 300, "completed", now, now))
+	mock.ExpectQuery(`SELECT ri.id, ri.redemption_id, ri.voucher_id, v.name, ri.quantity, ri.points_cost, ri.created_at
+		FROM redemption_items ri JOIN vouchers v ON v.id = ri.voucher_id
+		WHERE ri.redemption_id IN (?, ?) ORDER BY ri.id`).
+		WithArgs(9, 8).
+		WillReturnRows(sqlmock.NewRows(itemColumns).
+			AddRow(11, 8, 2, "Gift card", 1, 200, now).
+			AddRow(12, 9, 1, "Coffee", 1, 100, now))
+	mock.ExpectQuery(`SELECT vc.redemption_item_id, vc.code FROM voucher_codes vc
+		JOIN redemption_items ri ON ri.id = vc.redemption_item_id
+		WHERE ri.redemption_id IN (?, ?) ORDER BY vc.id`).
+		WithArgs(9, 8).
+		WillReturnRows(sqlmock.NewRows([]string{"redemption_item_id", "code"}).AddRow(11, "GIFT-0031"))
+
+	filter := models.RedemptionFilter{Status: "completed", From: from, PageRequest: models.PageRequest{Limit: 2}}
+	got, err := dbInstance.ListCustomerRedemptions(1, filter)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, got.Data, 2) {
+		assert.Equal(t, 9, got.Data[0].ID)
+		assert.Equal(t, "Coffee", got.Data[0].Items[0].VoucherName)
+		assert.Equal(t, 8, got.Data[1].ID)
+		assert.Equal(t, []string{"GIFT-0031"}, got.Data[1].Items[0].Codes)
+	}
+	assert.NotEmpty(t, got.NextCursor)
+
+	// The last page has no items to load and no cursor
+	mock.ExpectQuery(listRedemptions+" AND status = ? AND created_at >= ? AND id < ? ORDER BY id DESC LIMIT ?").
+		WithArgs(1, "completed", from, 8, 3).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	filter.Cursor = got.NextCursor
+	got, err = dbInstance.ListCustomerRedemptions(1, filter)
+	assert.NoError(t, err)
+	assert.Empty(t, got.Data)
+	assert.Empty(t, got.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateVoucherConstraintErrors(t *testing.T) {
+	const lockBrand = "SELECT archived_at FROM brands WHERE id = ? FOR UPDATE"
+	const reserve = "INSERT INTO reserved_codes (code) VALUES (?)"
+	const insert = `INSERT INTO vouchers (brand_id, code, name, description, points_cost, total_stock, remaining_stock, 
+	         per_customer_limit, limit_period, is_active, valid_from, valid_until) 
+	         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	tests := []struct {
+		name    string
+		setup   func(mock sqlmock.Sqlmock)
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name: "code reserved by a voucher or pool",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(9).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectExec(reserve).WithArgs("SAVE10").
+					WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'SAVE10' for key 'PRIMARY'"})
+				mock.ExpectRollback()
+			},
+			wantErr: ErrConflict,
+			wantMsg: `conflict: voucher code "SAVE10" already exists`,
+		},
+		{
+			name: "missing brand",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(9).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantErr: ErrInvalidReference,
+			wantMsg: "invalid reference: brand 9 does not exist",
+		},
+		{
+			name: "brand archived while the request ran",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(9).
+					WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(time.Now()))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrBrandArchived,
+		},
+		{
+			name: "lost connection",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(9).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectExec(reserve).WithArgs("SAVE10").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insert).WillReturnError(mysql.ErrInvalidConn)
+				mock.ExpectRollback()
+			},
+			wantErr: ErrUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.setup(mock)
+
+			_, err = NewDB(db).CreateVoucher(&models.Voucher{BrandID: 9, Code: "SAVE10", Name: "Save 10", PointsCost: 100})
+			assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			if tt.wantMsg != "" {
+				assert.EqualError(t, err, tt.wantMsg)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetVoucherNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT id, brand_id, code, name, description, points_cost, 
+		total_stock, remaining_stock, per_customer_limit, limit_period, code_pool, is_active, valid_from, valid_until, created_at, updated_at
+		FROM vouchers WHERE id = ? AND deleted_at IS NULL`).
+		WithArgs(5).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = NewDB(db).GetVoucher(5)
+	assert.True(t, errors.Is(err, ErrNotFound), "got %v", err)
+	assert.EqualError(t, err, "voucher 5: not found")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteVoucher(t *testing.T) {
+	const softDelete = `UPDATE vouchers SET is_active = false, deleted_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND deleted_at IS NULL`
+
+	tests := []struct {
+		name    string
+		rows    int64
+		wantErr error
+	}{
+		{name: "soft deletes the voucher", rows: 1},
+		{name: "missing or already deleted", rows: 0, wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectExec(softDelete).WithArgs(4).WillReturnResult(sqlmock.NewResult(0, tt.rows))
+
+			err = NewDB(db).DeleteVoucher(4)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestArchiveBrand(t *testing.T) {
+	const lockBrand = "SELECT archived_at FROM brands WHERE id = ? FOR UPDATE"
+
+	tests := []struct {
+		name        string
+		setup       func(mock sqlmock.Sqlmock)
+		wantChanged int
+		wantErr     error
+	}{
+		{
+			name: "archives brand and deactivates its vouchers",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectExec("UPDATE brands SET archived_at = CURRENT_TIMESTAMP WHERE id = ?").
+					WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE vouchers SET is_active = false, archived_with_brand = true
+		WHERE brand_id = ? AND is_active = true AND deleted_at IS NULL`).
+					WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 4))
+				mock.ExpectCommit()
+			},
+			wantChanged: 4,
+		},
+		{
+			name: "already archived",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(time.Now()))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "unknown brand",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "voucher update failure rolls back",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectExec("UPDATE brands SET archived_at = CURRENT_TIMESTAMP WHERE id = ?").
+					WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE vouchers SET is_active = false, archived_with_brand = true
+		WHERE brand_id = ? AND is_active = true AND deleted_at IS NULL`).
+					WithArgs(3).WillReturnError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+				mock.ExpectRollback()
+			},
+			wantErr: ErrUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.setup(mock)
+
+			changed, err := NewDB(db).ArchiveBrand(3)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantChanged, changed)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateVoucherCode(t *testing.T) {
+	const lockBrand = "SELECT archived_at FROM brands WHERE id = ? FOR UPDATE"
+	const lock = "SELECT code FROM vouchers WHERE id = ? AND brand_id = ? AND deleted_at IS NULL FOR UPDATE"
+	const update = `UPDATE vouchers SET code = ?, name = ?, description = ?, points_cost = ?,
+		per_customer_limit = ?, limit_period = ?, valid_from = ?, valid_until = ? WHERE id = ?`
+
+	tests := []struct {
+		name    string
+		setup   func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name: "old code is released and the new one reserved",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectQuery(lock).WithArgs(5, 3).WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("SAVE10"))
+				mock.ExpectExec("DELETE FROM reserved_codes WHERE code = ?").WithArgs("SAVE10").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO reserved_codes (code) VALUES (?)").WithArgs("SAVE20").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "change of case only",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectQuery(lock).WithArgs(5, 3).WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("save20"))
+				mock.ExpectExec("DELETE FROM reserved_codes WHERE code = ?").WithArgs("save20").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO reserved_codes (code) VALUES (?)").WithArgs("SAVE20").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "code reserved by a voucher or pool",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectQuery(lock).WithArgs(5, 3).WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("SAVE10"))
+				mock.ExpectExec("DELETE FROM reserved_codes WHERE code = ?").WithArgs("SAVE10").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO reserved_codes (code) VALUES (?)").WithArgs("SAVE20").
+					WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'SAVE20' for key 'PRIMARY'"})
+				mock.ExpectRollback()
+			},
+			wantErr: ErrConflict,
+		},
+		{
+			name: "unknown voucher",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectQuery(lock).WithArgs(5, 3).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.setup(mock)
+
+			err = NewDB(db).UpdateVoucher(&models.Voucher{ID: 5, BrandID: 3, Code: "SAVE20", Name: "Save 20", PointsCost: 200}, false, false)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateVoucherStock(t *testing.T) {
+	const lockBrand = "SELECT archived_at FROM brands WHERE id = ? FOR UPDATE"
+	const lock = "SELECT code FROM vouchers WHERE id = ? AND brand_id = ? AND deleted_at IS NULL FOR UPDATE"
+	const stock = "SELECT total_stock, remaining_stock FROM vouchers WHERE id = ?"
+	const update = `UPDATE vouchers SET code = ?, name = ?, description = ?, points_cost = ?,
+		per_customer_limit = ?, limit_period = ?, valid_from = ?, valid_until = ?,
+		total_stock = ?, remaining_stock = ? WHERE id = ?`
+	fields := []driver.Value{"SAVE10", "Save 10", "", 100, nil, nil, nil, nil}
+	intPtr := func(n int) *int { return &n }
+
+	tests := []struct {
+		name          string
+		total         *int
+		setup         func(mock sqlmock.Sqlmock)
+		wantRemaining *int
+		wantErr       error
+	}{
+		{
+			name:  "unlimited voucher gets a limit",
+			total: intPtr(50),
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(stock).WithArgs(5).
+					WillReturnRows(sqlmock.NewRows([]string{"total_stock", "remaining_stock"}).AddRow(nil, nil))
+				mock.ExpectExec(update).WithArgs(append(fields, 50, 50, 5)...).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantRemaining: intPtr(50),
+		},
+		{
+			name:  "raised limit adds to the remaining stock",
+			total: intPtr(120),
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(stock).WithArgs(5).
+					WillReturnRows(sqlmock.NewRows([]string{"total_stock", "remaining_stock"}).AddRow(100, 30))
+				mock.ExpectExec(update).WithArgs(append(fields, 120, 50, 5)...).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantRemaining: intPtr(50),
+		},
+		{
+			name:  "limit below the units already taken",
+			total: intPtr(60),
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(stock).WithArgs(5).
+					WillReturnRows(sqlmock.NewRows([]string{"total_stock", "remaining_stock"}).AddRow(100, 30))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrInvalidStock,
+		},
+		{
+			name: "limit removed",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(update).WithArgs(append(fields, nil, nil, 5)...).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+			mock.ExpectQuery(lock).WithArgs(5, 3).WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("SAVE10"))
+			tt.setup(mock)
+
+			voucher := &models.Voucher{ID: 5, BrandID: 3, Code: "SAVE10", Name: "Save 10", PointsCost: 100,
+				TotalStock: tt.total, RemainingStock: intPtr(30)}
+			err = NewDB(db).UpdateVoucher(voucher, false, true)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantRemaining, voucher.RemainingStock)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateVoucherOverridesArchiving(t *testing.T) {
+	const lockBrand = "SELECT archived_at FROM brands WHERE id = ? FOR UPDATE"
+	const update = `UPDATE vouchers SET code = ?, name = ?, description = ?, points_cost = ?,
+		per_customer_limit = ?, limit_period = ?, valid_from = ?, valid_until = ?`
+	const lockVoucher = "SELECT code FROM vouchers WHERE id = ? AND brand_id = ? AND deleted_at IS NULL FOR UPDATE"
+	const where = " WHERE id = ?"
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+	dbInstance := NewDB(db)
+	voucher := &models.Voucher{ID: 5, BrandID: 3, Code: "SAVE10", Name: "Save 10", PointsCost: 100}
+
+	// Archiving flags the brand's active voucher
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockBrand).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+	mock.ExpectExec("UPDATE brands SET archived_at = CURRENT_TIMESTAMP WHERE id = ?").
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE vouchers SET is_active = false, archived_with_brand = true
+		WHERE brand_id = ? AND is_active = true AND deleted_at IS NULL`).
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// An edit that leaves is_active alone writes neither it nor the flag, so
+	// it cannot switch the voucher back on; one that sets it clears the flag,
+	// but switching the voucher on is refused while the brand is archived
+	fields := []driver.Value{"SAVE10", "Save 10", "", 100, nil, nil, nil, nil}
+	archived := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"archived_at"}).AddRow(time.Now()) }
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnRows(archived())
+	mock.ExpectQuery(lockVoucher).WithArgs(5, 3).WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("SAVE10"))
+	mock.ExpectExec(update + where).WithArgs(append(fields, 5)...).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnRows(archived())
+	mock.ExpectQuery(lockVoucher).WithArgs(5, 3).WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("SAVE10"))
+	mock.ExpectExec(update + ", is_active = ?, archived_with_brand = false" + where).
+		WithArgs(append(fields, false, 5)...).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnRows(archived())
+	mock.ExpectRollback()
+
+	// So restoring finds no flagged voucher to reactivate
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockBrand).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(time.Now()))
+	mock.ExpectExec("UPDATE brands SET archived_at = NULL WHERE id = ?").
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE vouchers SET is_active = true, archived_with_brand = false
+		WHERE brand_id = ? AND archived_with_brand = true AND deleted_at IS NULL`).
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	changed, err := dbInstance.ArchiveBrand(3)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	assert.NoError(t, dbInstance.UpdateVoucher(voucher, false, false))
+	assert.NoError(t, dbInstance.UpdateVoucher(voucher, true, false))
+	active := *voucher
+	active.IsActive = true
+	err = dbInstance.UpdateVoucher(&active, true, false)
+	assert.True(t, errors.Is(err, models.ErrBrandArchived), "got %v", err)
+	changed, err = dbInstance.RestoreBrand(3)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, changed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetVoucherActive(t *testing.T) {
+	const brandOf = "SELECT brand_id FROM vouchers WHERE id = ? AND deleted_at IS NULL"
+	const lockBrand = "SELECT archived_at FROM brands WHERE id = ? FOR UPDATE"
+	const update = `UPDATE vouchers SET is_active = ?, archived_with_brand = false
+		WHERE id = ? AND deleted_at IS NULL`
+
+	tests := []struct {
+		name    string
+		active  bool
+		setup   func(mock sqlmock.Sqlmock)
+		wantErr error
+	}{
+		{
+			name:   "activate under an open brand",
+			active: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(brandOf).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"brand_id"}).AddRow(3))
+				mock.ExpectQuery(lockBrand).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectExec(update).WithArgs(true, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:   "brand archived while the request ran",
+			active: true,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(brandOf).WithArgs(5).WillReturnRows(sqlmock.NewRows([]string{"brand_id"}).AddRow(3))
+				mock.ExpectQuery(lockBrand).WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(time.Now()))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrBrandArchived,
+		},
+		{
+			name:   "deactivate needs no brand",
+			active: false,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(update).WithArgs(false, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.setup(mock)
+
+			err = NewDB(db).SetVoucherActive(5, tt.active)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListVouchersExcludeExpired(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT id, brand_id, code, name, description, points_cost,
+		total_stock, remaining_stock, per_customer_limit, limit_period, code_pool, is_active, valid_from, valid_until, created_at, updated_at
+		FROM vouchers WHERE deleted_at IS NULL AND (valid_until IS NULL OR valid_until > ?) ORDER BY id ASC LIMIT ?`).
+		WithArgs(sqlmock.AnyArg(), 51).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "brand_id", "code", "name", "description",
+			"points_cost", "total_stock", "remaining_stock", "per_customer_limit", "limit_period", "code_pool", "is_active", "valid_from", "valid_until", "created_at", "updated_at",
+		}).AddRow(1, 1, "OPEN", "No expiry", "", 100, nil, nil, nil, nil, false, true, nil, nil, now, now))
+
+	page, err := NewDB(db).ListVouchers(models.VoucherFilter{ExcludeExpired: true})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Data, 1) {
+		assert.True(t, page.Data[0].ValidFrom.IsZero())
+		assert.True(t, page.Data[0].ValidUntil.IsZero())
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListVouchersPagination(t *testing.T) {
+	const listBySort = `SELECT id, brand_id, code, name, description, points_cost,
+		total_stock, remaining_stock, per_customer_limit, limit_period, code_pool, is_active, valid_from, valid_until, created_at, updated_at
+		FROM vouchers WHERE deleted_at IS NULL AND is_active = ?`
+	columns := []string{
+		"id", "brand_id", "code", "name", "description", "points_cost", "total_stock",
+		"remaining_stock", "per_customer_limit", "limit_period", "code_pool", "is_active", "valid_from", "valid_until", "created_at", "updated_at",
+	}
+	now := time.Now()
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+	dbInstance := NewDB(db)
+	active := true
+
+	// One row more than the page size means another page follows
+	mock.ExpectQuery(listBySort+" ORDER BY points_cost DESC, id DESC LIMIT ?").
+		WithArgs(true, 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(7, 1, "C7", "Spa day", "", 900, nil, nil, nil, nil, false, true, nil, nil, now, now).
+			AddRow(3, 1, "C3", "Dinner", "", 500, nil, nil, nil, nil, false, true, nil, nil, now, now).
+			AddRow(5, 1, "C5", "Lunch", "", 500, nil, nil, nil, nil, false, true, nil, nil, now, now))
+
+	filter := models.VoucherFilter{Active: &active, PageRequest: models.PageRequest{Sort: "-points_cost", Limit: 2}}
+	first, err := dbInstance.ListVouchers(filter)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, first.Data, 2)
+	assert.NotEmpty(t, first.NextCursor)
+
+	// The next page starts after the last row returned, with ties broken by ID
+	mock.ExpectQuery(listBySort+" AND (points_cost < ? OR (points_cost = ? AND id < ?)) ORDER BY points_cost DESC, id DESC LIMIT ?").
+		WithArgs(true, 500, 500, 3, 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(5, 1, "C5", "Lunch", "", 500, nil, nil, nil, nil, false, true, nil, nil, now, now))
+
+	filter.Cursor = first.NextCursor
+	second, err := dbInstance.ListVouchers(filter)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, second.Data, 1)
+	assert.Empty(t, second.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// A cursor only works with the sort it was issued for
+	filter.Sort = "name"
+	_, err = dbInstance.ListVouchers(filter)
+	assert.True(t, errors.Is(err, models.ErrInvalidCursor), "got %v", err)
+
+	filter.Cursor = "not-a-cursor"
+	_, err = dbInstance.ListVouchers(filter)
+	assert.True(t, errors.Is(err, models.ErrInvalidCursor), "got %v", err)
+
+	_, err = dbInstance.ListVouchers(models.VoucherFilter{PageRequest: models.PageRequest{Sort: "remaining_stock"}})
+	assert.True(t, errors.Is(err, models.ErrInvalidSort), "got %v", err)
+}
+
+func TestListBrandsFilters(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT id, tenant_id, name, description, archived_at, created_at, updated_at FROM brands
+		WHERE 1 = 1 AND archived_at IS NULL AND name LIKE ? ORDER BY name ASC, id ASC LIMIT ?`).
+		WithArgs(`%50\%%`, 51).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "tenant_id", "name", "description", "archived_at", "created_at", "updated_at"}).
+			AddRow(2, nil, "50% Off", "", nil, now, now))
+
+	archived := false
+	page, err := NewDB(db).ListBrands(models.BrandFilter{
+		Archived:    &archived,
+		Search:      "50%",
+		PageRequest: models.PageRequest{Sort: "name"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Data, 1) {
+		assert.Equal(t, "50% Off", page.Data[0].Name)
+	}
+	assert.Empty(t, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestockVoucher(t *testing.T) {
+	const restock = `UPDATE vouchers SET total_stock = total_stock + ?, remaining_stock = remaining_stock + ?
+		WHERE id = ? AND total_stock IS NOT NULL AND deleted_at IS NULL`
+	const getVoucher = `SELECT id, brand_id, code, name, description, points_cost, total_stock,
+		remaining_stock, per_customer_limit, limit_period, code_pool, is_active, valid_from, valid_until, created_at, updated_at
+		FROM vouchers WHERE id = ? AND deleted_at IS NULL`
+	columns := []string{
+		"id", "brand_id", "code", "name", "description", "points_cost", "total_stock",
+		"remaining_stock", "per_customer_limit", "limit_period", "code_pool", "is_active", "valid_from", "valid_until", "created_at", "updated_at",
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		setup         func(mock sqlmock.Sqlmock)
+		wantRemaining int
+		wantErr       error
+	}{
+		{
+			name: "adds to total and remaining stock",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(restock).WithArgs(20, 20, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(getVoucher).WithArgs(4).WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(4, 1, "LIMITED", "Limited", "", 100, 120, 25, nil, nil, false, true, nil, nil, now, now))
+			},
+			wantRemaining: 25,
+		},
+		{
+			name: "unlimited voucher",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(restock).WithArgs(20, 20, 4).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(getVoucher).WithArgs(4).WillReturnRows(sqlmock.NewRows(columns).
+					AddRow(4, 1, "OPEN", "Open", "", 100, nil, nil, nil, nil, false, true, nil, nil, now, now))
+			},
+			wantErr: models.ErrStockNotLimited,
+		},
+		{
+			name: "unknown voucher",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(restock).WithArgs(20, 20, 4).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(getVoucher).WithArgs(4).WillReturnError(sql.ErrNoRows)
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.setup(mock)
+
+			got, err := NewDB(db).RestockVoucher(4, 20)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.wantRemaining, *got.RemainingStock)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAddVoucherCodes(t *testing.T) {
+	const lock = "SELECT id FROM vouchers WHERE id = ? AND deleted_at IS NULL FOR UPDATE"
+	const reserve = "INSERT INTO reserved_codes (code) VALUES (?), (?)"
+	const insert = "INSERT INTO voucher_codes (voucher_id, code) VALUES (?, ?), (?, ?)"
+
+	tests := []struct {
+		name    string
+		setup   func(mock sqlmock.Sqlmock)
+		want    *models.VoucherCodePool
+		wantErr error
+	}{
+		{
+			name: "adds codes and enables the pool",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lock).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectExec(reserve).WithArgs("A1", "B2").WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(insert).WithArgs(3, "A1", 3, "B2").WillReturnResult(sqlmock.NewResult(1, 2))
+				mock.ExpectExec("UPDATE vouchers SET code_pool = true WHERE id = ?").
+					WithArgs(3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT COUNT(*) FROM voucher_codes WHERE voucher_id = ? AND redemption_item_id IS NULL").
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+				mock.ExpectCommit()
+			},
+			want: &models.VoucherCodePool{VoucherID: 3, Added: 2, Available: 5},
+		},
+		{
+			name: "code already reserved by a voucher or pool",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lock).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectExec(reserve).WithArgs("A1", "B2").
+					WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'B2' for key 'PRIMARY'"})
+				mock.ExpectRollback()
+			},
+			wantErr: ErrConflict,
+		},
+		{
+			name: "unknown voucher",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lock).WithArgs(3).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.setup(mock)
+
+			got, err := NewDB(db).AddVoucherCodes(3, []string{"A1", "B2"})
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAssignCodes(t *testing.T) {
+	const assign = `UPDATE voucher_codes SET redemption_item_id = ?, assigned_at = CURRENT_TIMESTAMP
+			WHERE id IN (?, ?)`
+
+	tests := []struct {
+		name      string
+		setup     func(mock sqlmock.Sqlmock)
+		wantCodes []string
+		wantErr   error
+	}{
+		{
+			name: "locks and assigns unused codes",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(nextPoolCodes).WithArgs(2, 2).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(31, "GIFT-0031").AddRow(32, "GIFT-0032"))
+				mock.ExpectExec(assign).WithArgs(9, 31, 32).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectRollback()
+			},
+			wantCodes: []string{"GIFT-0031", "GIFT-0032"},
+		},
+		{
+			name: "too few unused codes",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(nextPoolCodes).WithArgs(2, 2).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(31, "GIFT-0031"))
+				mock.ExpectRollback()
+			},
+			wantErr: models.ErrOutOfStock,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.setup(mock)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatalf("Failed to begin transaction: %v", err)
+			}
+			items := []models.RedemptionItem{
+				{ID: 8, VoucherID: 1, Quantity: 1},
+				{ID: 9, VoucherID: 2, Quantity: 2},
+			}
+			err = assignCodes(tx, items, map[int]bool{2: true})
+			assert.NoError(t, tx.Rollback())
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else if assert.NoError(t, err) {
+				assert.Nil(t, items[0].Codes)
+				assert.Equal(t, tt.wantCodes, items[1].Codes)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	const purge = "DELETE FROM idempotency_keys WHERE scope = ? AND idem_key = ? AND expires_at <= ?"
+	const insert = `INSERT INTO idempotency_keys (scope, idem_key, request_hash, expires_at)
+		VALUES (?, ?, ?, ?)`
+	const lookup = `SELECT request_hash, status_code, response_body, expires_at
+		FROM idempotency_keys WHERE scope = ? AND idem_key = ?`
+	expires := time.Now().Add(time.Hour)
+	record := &models.IdempotencyRecord{Scope: "POST /redemptions", Key: "k1", RequestHash: "abc", ExpiresAt: expires}
+
+	tests := []struct {
+		name  string
+		setup func(mock sqlmock.Sqlmock)
+		want  *models.IdempotencyRecord
+	}{
+		{
+			name: "new key is claimed",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(purge).WithArgs("POST /redemptions", "k1", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(insert).WithArgs("POST /redemptions", "k1", "abc", expires).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			name: "used key returns the stored response",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(purge).WithArgs("POST /redemptions", "k1", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(insert).WithArgs("POST /redemptions", "k1", "abc", expires).
+					WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+				mock.ExpectQuery(lookup).WithArgs("POST /redemptions", "k1").
+					WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body", "expires_at"}).
+						AddRow("abc", 201, []byte(`{"id":7}`), expires))
+			},
+			want: &models.IdempotencyRecord{
+				Scope: "POST /redemptions", Key: "k1", RequestHash: "abc",
+				StatusCode: 201, Body: []byte(`{"id":7}`), ExpiresAt: expires,
+			},
+		},
+		{
+			name: "key still in flight",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(purge).WithArgs("POST /redemptions", "k1", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(insert).WithArgs("POST /redemptions", "k1", "abc", expires).
+					WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+				mock.ExpectQuery(lookup).WithArgs("POST /redemptions", "k1").
+					WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body", "expires_at"}).
+						AddRow("abc", nil, nil, expires))
+			},
+			want: &models.IdempotencyRecord{Scope: "POST /redemptions", Key: "k1", RequestHash: "abc", ExpiresAt: expires},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+
+			tt.setup(mock)
+
+			got, err := NewDB(db).ClaimIdempotencyKey(record)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	const selectKey = "SELECT id, tenant_id, name, key_prefix, scopes, revoked_at, created_at FROM api_keys WHERE "
+	columns := []string{"id", "tenant_id", "name", "key_prefix", "scopes", "revoked_at", "created_at"}
+	now := time.Now()
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("Failed to create mock database connection: %v", err)
+	}
+	defer db.Close()
+	dbInstance := NewDB(db)
+
+	mock.ExpectExec("INSERT INTO api_keys (tenant_id, name, key_prefix, key_hash, scopes) VALUES (?, ?, ?, ?, ?)").
+		WithArgs(nil, "pos", "vk_abcdefgh", "hash", "redeem,read").
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectQuery(selectKey + "id = ?").WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(4, nil, "pos", "vk_abcdefgh", "redeem,read", nil, now))
+
+	key := &models.APIKey{Name: "pos", Prefix: "vk_abcdefgh", Scopes: []string{"redeem", "read"}}
+	assert.NoError(t, dbInstance.CreateAPIKey(key, "hash"))
+	assert.Equal(t, 4, key.ID)
+	assert.False(t, key.CreatedAt.IsZero())
+
+	// Revoked keys no longer match
+	mock.ExpectQuery(selectKey + "key_hash = ? AND revoked_at IS NULL").WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(4, nil, "pos", "vk_abcdefgh", "redeem,read", nil, now))
+	mock.ExpectExec("UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL").
+		WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(selectKey + "key_hash = ? AND revoked_at IS NULL").WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectExec("UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL").
+		WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	got, err := dbInstance.GetAPIKeyByHash("hash")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"redeem", "read"}, got.Scopes)
+	}
+	assert.NoError(t, dbInstance.RevokeAPIKey(4))
+	_, err = dbInstance.GetAPIKeyByHash("hash")
+	assert.True(t, errors.Is(err, ErrNotFound), "got %v", err)
+	err = dbInstance.RevokeAPIKey(4)
+	assert.True(t, errors.Is(err, ErrNotFound), "got %v", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTenantScope(t *testing.T) {
+	const brandScope = " AND brand_id IN (SELECT id FROM brands WHERE tenant_id = ?)"
+
+	tests := []struct {
+		name    string
+		setup   func(mock sqlmock.Sqlmock)
+		run     func(d *DB) error
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name: "other tenant's brand is not found",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT id, tenant_id, name, description, archived_at, created_at, updated_at FROM brands WHERE id = ? AND tenant_id = ?").
+					WithArgs(7, 3).WillReturnError(sql.ErrNoRows)
+			},
+			run: func(d *DB) error {
+				_, err := d.GetBrand(7)
+				return err
+			},
+			wantErr: ErrNotFound,
+			wantMsg: "brand 7: not found",
+		},
+		{
+			name: "other tenant's voucher is not found",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id, brand_id, code, name, description, points_cost,
+					total_stock, remaining_stock, per_customer_limit, limit_period, code_pool, is_active, valid_from, valid_until, created_at, updated_at
+					FROM vouchers WHERE id = ? AND deleted_at IS NULL`+brandScope).
+					WithArgs(5, 3).WillReturnError(sql.ErrNoRows)
+			},
+			run: func(d *DB) error {
+				_, err := d.GetVoucher(5)
+				return err
+			},
+			wantErr: ErrNotFound,
+			wantMsg: "voucher 5: not found",
+		},
+		{
+			name: "other tenant's voucher cannot be deleted",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE vouchers SET is_active = false, deleted_at = CURRENT_TIMESTAMP
+					WHERE id = ? AND deleted_at IS NULL`+brandScope).
+					WithArgs(5, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			run: func(d *DB) error {
+				return d.DeleteVoucher(5)
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "vouchers cannot be added to other tenant's brand",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT archived_at FROM brands WHERE id = ? AND tenant_id = ? FOR UPDATE").
+					WithArgs(9, 3).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			run: func(d *DB) error {
+				_, err := d.CreateVoucher(&models.Voucher{BrandID: 9, Code: "SAVE10", Name: "Save 10", PointsCost: 100})
+				return err
+			},
+			wantErr: ErrInvalidReference,
+			wantMsg: "invalid reference: brand 9 does not exist",
+		},
+		{
+			name: "code taken by another tenant is not named",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT archived_at FROM brands WHERE id = ? AND tenant_id = ? FOR UPDATE").
+					WithArgs(9, 3).WillReturnRows(sqlmock.NewRows([]string{"archived_at"}).AddRow(nil))
+				mock.ExpectExec("INSERT INTO reserved_codes (code) VALUES (?)").WithArgs("SAVE10").
+					WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'SAVE10' for key 'PRIMARY'"})
+				mock.ExpectRollback()
+			},
+			run: func(d *DB) error {
+				_, err := d.CreateVoucher(&models.Voucher{BrandID: 9, Code: "SAVE10", Name: "Save 10", PointsCost: 100})
+				return err
+			},
+			wantErr: ErrConflict,
+			wantMsg: "conflict: voucher code is not available",
+		},
+		{
+			name: "brands are created for the tenant",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO brands (tenant_id, name, description) VALUES (?, ?, ?)").
+					WithArgs(3, "Acme", "").WillReturnResult(sqlmock.NewResult(12, 1))
+			},
+			run: func(d *DB) error {
+				other := 4
+				brand := &models.Brand{Name: "Acme", TenantID: &other}
+				if _, err := d.CreateBrand(brand); err != nil {
+					return err
+				}
+				if *brand.TenantID != 3 {
+					return fmt.Errorf("brand created for tenant %d", *brand.TenantID)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			if err != nil {
+				t.Fatalf("Failed to create mock database connection: %v", err)
+			}
+			defer db.Close()
+			tt.setup(mock)
+
+			err = tt.run(NewDB(db).ForTenant(3))
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tt.wantMsg != "" {
+				assert.EqualError(t, err, tt.wantMsg)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
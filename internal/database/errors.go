@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Errors returned by this package classify what went wrong independently of
+// the driver. They are always wrapped with a message naming the record
+// involved, so test for them with errors.Is.
+var (
+	// ErrNotFound means the requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the write clashes with an existing record
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidReference means the write points at a record that does not exist
+	ErrInvalidReference = errors.New("invalid reference")
+	// ErrUnavailable means the database could not be reached or gave up on the
+	// statement; retrying later may succeed
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// MySQL server error numbers
+const (
+	mysqlTooManyConnections = 1040
+	mysqlDuplicateEntry     = 1062
+	mysqlLockWaitTimeout    = 1205
+	mysqlDeadlock           = 1213
+	mysqlNoReferencedRow    = 1452
+)
+
+// isDuplicateEntry reports whether err is a unique constraint violation
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+// isMissingReference reports whether err is a foreign key violation caused by
+// referencing a row that does not exist
+func isMissingReference(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlNoReferencedRow
+}
+
+// isUnavailable reports whether err means the database could not serve the
+// request rather than that the request itself was wrong
+func isUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case mysqlTooManyConnections, mysqlLockWaitTimeout, mysqlDeadlock:
+			return true
+		}
+	}
+	return false
+}
+
+// translateError maps driver errors onto this package's errors. Errors that
+// are already meaningful, such as model validation errors, pass through.
+// Callers that know which record was involved should wrap the result with a
+// more specific message.
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrConflict),
+		errors.Is(err, ErrInvalidReference), errors.Is(err, ErrUnavailable):
+		return err
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case isDuplicateEntry(err):
+		return ErrConflict
+	case isMissingReference(err):
+		return ErrInvalidReference
+	case isUnavailable(err):
+		// Keep the cause so it can be logged; it is never shown to clients
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// notFound translates err, naming the record when it does not exist
+func notFound(err error, entity string, id int) error {
+	if errors.Is(err, sql.ErrNoRows) || err == ErrNotFound {
+		return fmt.Errorf("%s %d: %w", entity, id, ErrNotFound)
+	}
+	return translateError(err)
+}
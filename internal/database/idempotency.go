@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"voucher-api/internal/models"
+)
+
+// ClaimIdempotencyKey records that a request with the given key is being
+// handled. When the key is new, or its earlier use has expired, it is claimed
+// and nil is returned. Otherwise the stored record is returned and nothing
+// changes; its StatusCode is zero if that request has not finished yet.
+func (d *DB) ClaimIdempotencyKey(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	_, err := d.db.Exec("DELETE FROM idempotency_keys WHERE scope = ? AND idem_key = ? AND expires_at <= ?",
+		record.Scope, record.Key, time.Now())
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	_, err = d.db.Exec(`INSERT INTO idempotency_keys (scope, idem_key, request_hash, expires_at)
+		VALUES (?, ?, ?, ?)`, record.Scope, record.Key, record.RequestHash, record.ExpiresAt)
+	if err == nil {
+		return nil, nil
+	}
+	if !isDuplicateEntry(err) {
+		return nil, translateError(err)
+	}
+
+	existing := models.IdempotencyRecord{Scope: record.Scope, Key: record.Key}
+	var status sql.NullInt64
+	err = d.db.QueryRow(`SELECT request_hash, status_code, response_body, expires_at
+		FROM idempotency_keys WHERE scope = ? AND idem_key = ?`, record.Scope, record.Key).
+		Scan(&existing.RequestHash, &status, &existing.Body, &existing.ExpiresAt)
+	if err == sql.ErrNoRows {
+		// The earlier use expired and was purged in between
+		return nil, fmt.Errorf("%w: idempotency key %q changed concurrently", ErrConflict, record.Key)
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+	existing.StatusCode = int(status.Int64)
+	return &existing, nil
+}
+
+// SaveIdempotentResponse stores the response to a request whose key was
+// claimed, so retries can be answered with it
+func (d *DB) SaveIdempotentResponse(scope, key string, status int, body []byte) error {
+	_, err := d.db.Exec(`UPDATE idempotency_keys SET status_code = ?, response_body = ?
+		WHERE scope = ? AND idem_key = ?`, status, body, scope, key)
+	return translateError(err)
+}
+
+// PurgeExpiredIdempotencyKeys deletes stored responses whose retention
+// window has passed and returns how many were removed
+func (d *DB) PurgeExpiredIdempotencyKeys() (int, error) {
+	result, err := d.db.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", time.Now())
+	if err != nil {
+		return 0, translateError(err)
+	}
+	n, err := result.RowsAffected()
+	return int(n), translateError(err)
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"voucher-api/internal/models"
+)
+
+// RecordPointsEntry applies a ledger entry to the customer's balance and
+// stores it in the ledger in a single transaction
+func (d *DB) RecordPointsEntry(entry *models.PointsLedgerEntry) error {
+	if err := entry.Validate(); err != nil {
+		return translateError(err)
+	}
+
+	tx, err := d.BeginTx()
+	if err != nil {
+		return translateError(err)
+	}
+	defer tx.Rollback()
+
+	if err := postLedgerEntry(tx, entry); err != nil {
+		return notFound(err, "customer", entry.CustomerID)
+	}
+	return translateError(tx.Commit())
+}
+
+// GetPointsLedger retrieves a customer's ledger entries, oldest first
+func (d *DB) GetPointsLedger(customerID int) ([]models.PointsLedgerEntry, error) {
+	rows, err := d.db.Query(`SELECT `+ledgerColumns+`
+		FROM points_ledger WHERE customer_id = ? ORDER BY id`, customerID)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	entries := []models.PointsLedgerEntry{}
+	for rows.Next() {
+		e, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, translateError(err)
+		}
+		entries = append(entries, *e)
+	}
+	return entries, translateError(rows.Err())
+}
+
+// CreditPoints applies a batch of credits in one transaction; either every
+// credit is recorded or none are. A credit whose idempotency key has already
+// been applied is not credited again and the original entry is returned; if
+// the earlier credit differed in any field, ErrIdempotencyConflict is.
+func (d *DB) CreditPoints(credits []models.PointsCredit) ([]models.PointsCreditResult, error) {
+	tx, err := d.BeginTx()
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer tx.Rollback()
+
+	if err := lockCreditCustomers(tx, credits); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.PointsCreditResult, 0, len(credits))
+	for i, credit := range credits {
+		result, err := creditPoints(tx, credit)
+		if err != nil {
+			return nil, fmt.Errorf("credit %d: %w", i, notFound(err, "customer", credit.CustomerID))
+		}
+		results = append(results, *result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, translateError(err)
+	}
+	return results, nil
+}
+
+// ReconcileCustomerPoints compares a customer's stored balance against the
+// sum of their ledger entries
+func (d *DB) ReconcileCustomerPoints(customerID int) (*models.PointsReconciliation, error) {
+	rec := models.PointsReconciliation{CustomerID: customerID}
+	err := d.db.QueryRow(`SELECT c.points_balance, COALESCE(SUM(l.amount), 0)
+		FROM customers c LEFT JOIN points_ledger l ON l.customer_id = c.id
+		WHERE c.id = ? GROUP BY c.id, c.points_balance`, customerID).
+		Scan(&rec.Balance, &rec.LedgerBalance)
+	if err != nil {
+		return nil, notFound(err, "customer", customerID)
+	}
+	rec.Difference = rec.Balance - rec.LedgerBalance
+	rec.Balanced = rec.Difference == 0
+	return &rec, nil
+}
+
+const ledgerColumns = `id, customer_id, entry_type, amount, balance_after,
+		reference_type, reference_id, description, idempotency_key, created_at`
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLedgerEntry(s scanner) (*models.PointsLedgerEntry, error) {
+	var e models.PointsLedgerEntry
+	var key sql.NullString
+	if err := s.Scan(&e.ID, &e.CustomerID, &e.EntryType, &e.Amount, &e.BalanceAfter,
+		&e.ReferenceType, &e.ReferenceID, &e.Description, &key, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	e.IdempotencyKey = key.String
+	return &e, nil
+}
+
+// lockCreditCustomers validates a batch of credits and locks each distinct
+// customer in ascending ID order, so concurrent batches naming the same
+// customers in a different order cannot deadlock
+func lockCreditCustomers(tx *sql.Tx, credits []models.PointsCredit) error {
+	first := map[int]int{}
+	var ids []int
+	for i, credit := range credits {
+		if err := credit.Validate(); err != nil {
+			return fmt.Errorf("credit %d: %w", i, err)
+		}
+		if _, ok := first[credit.CustomerID]; !ok {
+			first[credit.CustomerID] = i
+			ids = append(ids, credit.CustomerID)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		if _, _, err := lockCustomerBalance(tx, id); err != nil {
+			return fmt.Errorf("credit %d: %w", first[id], notFound(err, "customer", id))
+		}
+	}
+	return nil
+}
+
+// creditPoints applies a single credit inside tx. The customer row must
+// already be locked, so two retries of the same credit cannot both miss the
+// idempotency key lookup and credit twice.
+func creditPoints(tx *sql.Tx, credit models.PointsCredit) (*models.PointsCreditResult, error) {
+	existing, err := scanLedgerEntry(tx.QueryRow(`SELECT `+ledgerColumns+`
+		FROM points_ledger WHERE idempotency_key = ?`, credit.IdempotencyKey))
+	if err == nil {
+		if !sameCredit(existing, credit) {
+			return nil, models.ErrIdempotencyConflict
+		}
+		return &models.PointsCreditResult{Entry: *existing, Duplicate: true}, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	entry := models.PointsLedgerEntry{
+		CustomerID:     credit.CustomerID,
+		EntryType:      models.LedgerEarn,
+		Amount:         credit.Points,
+		ReferenceType:  credit.Source,
+		ReferenceID:    credit.ExternalReference,
+		Description:    credit.Description,
+		IdempotencyKey: credit.IdempotencyKey,
+	}
+	if err := postLedgerEntry(tx, &entry); err != nil {
+		return nil, err
+	}
+	return &models.PointsCreditResult{Entry: entry}, nil
+}
+
+// sameCredit reports whether a stored entry records exactly this credit, so
+// that reusing a key for a different credit is a conflict, not a replay
+func sameCredit(entry *models.PointsLedgerEntry, credit models.PointsCredit) bool {
+	return entry.EntryType == models.LedgerEarn &&
+		entry.CustomerID == credit.CustomerID &&
+		entry.Amount == credit.Points &&
+		entry.ReferenceType == credit.Source &&
+		entry.ReferenceID == credit.ExternalReference &&
+		entry.Description == credit.Description
+}
+
+// nullString maps an empty string to NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// postLedgerEntry moves the customer's balance by entry.Amount and records
+// the entry with the resulting balance. Debits go through deductPoints so the
+// balance can never go negative.
+func postLedgerEntry(tx *sql.Tx, entry *models.PointsLedgerEntry) error {
+	if entry.Amount < 0 {
+		if err := deductPoints(tx, entry.CustomerID, -entry.Amount); err != nil {
+			return err
+		}
+	} else {
+		result, err := tx.Exec("UPDATE customers SET points_balance = points_balance + ? WHERE id = ?",
+			entry.Amount, entry.CustomerID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+	}
+
+	err := tx.QueryRow("SELECT points_balance FROM customers WHERE id = ?", entry.CustomerID).
+		Scan(&entry.BalanceAfter)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`INSERT INTO points_ledger
+		(customer_id, entry_type, amount, balance_after, reference_type, reference_id, description, idempotency_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.CustomerID, entry.EntryType, entry.Amount, entry.BalanceAfter,
+		entry.ReferenceType, entry.ReferenceID, entry.Description, nullString(entry.IdempotencyKey))
+	if isDuplicateEntry(err) {
+		return models.ErrIdempotencyConflict
+	}
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = int(id)
+	return nil
+}
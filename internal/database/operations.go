@@ -2,12 +2,16 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"time"
 	"voucher-api/internal/models"
 )
 
-// DB holds the database connection
+// DB holds the database connection. tenantID, when set, limits brand and
+// voucher queries to one tenant; see ForTenant.
 type DB struct {
-	db *sql.DB
+	db       *sql.DB
+	tenantID int
 }
 
 // NewDB creates a new DB instance
@@ -15,46 +19,16 @@ func NewDB(db *sql.DB) *DB {
 	return &DB{db: db}
 }
 
-// GetVouchersByBrand retrieves all vouchers for a given brand ID
-func (d *DB) GetVouchersByBrand(brandID int) ([]models.Voucher, error) {
-	query := `
-		SELECT id, brand_id, code, name, description, points_cost, 
-		       is_active, valid_until, created_at, updated_at
-		FROM vouchers 
-		WHERE brand_id = ?`
-
-	rows, err := d.db.Query(query, brandID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var vouchers []models.Voucher
-	for rows.Next() {
-		var v models.Voucher
-		err := rows.Scan(
-			&v.ID,
-			&v.BrandID,
-			&v.Code,
-			&v.Name,
-			&v.Description,
-			&v.PointsCost,
-			&v.IsActive,
-			&v.ValidUntil,
-			&v.CreatedAt,
-			&v.UpdatedAt,
-		)
-		if err != nil {
+// GetVouchersByBrand retrieves a page of the vouchers of a brand. For a
+// tenant, another tenant's brand is not found rather than listed as empty.
+func (d *DB) GetVouchersByBrand(brandID int, filter models.VoucherFilter) (*models.Page[models.Voucher], error) {
+	if d.tenantID != 0 {
+		if _, err := d.GetBrand(brandID); err != nil {
 			return nil, err
 		}
-		vouchers = append(vouchers, v)
 	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return vouchers, nil
+	filter.BrandID = brandID
+	return d.ListVouchers(filter)
 }
 
 // Close closes the database connection
@@ -64,133 +38,244 @@ func (d *DB) Close() error {
 
 // BeginTx starts a new transaction
 func (d *DB) BeginTx() (*sql.Tx, error) {
-	return d.db.Begin()
+	tx, err := d.db.Begin()
+	return tx, translateError(err)
 }
 
-// CreateBrand creates a new brand
+// CreateBrand creates a new brand. Brands created for a tenant belong to it
+// whatever brand.TenantID says.
 func (d *DB) CreateBrand(brand *models.Brand) (int, error) {
-	query := `INSERT INTO brands (name, description) VALUES (?, ?)`
-	result, err := d.db.Exec(query, brand.Name, brand.Description)
+	if d.tenantID != 0 {
+		tenantID := d.tenantID
+		brand.TenantID = &tenantID
+	}
+	query := `INSERT INTO brands (tenant_id, name, description) VALUES (?, ?, ?)`
+	result, err := d.db.Exec(query, nullInt(brand.TenantID), brand.Name, brand.Description)
+	if isMissingReference(err) {
+		return 0, fmt.Errorf("%w: tenant %d does not exist", ErrInvalidReference, *brand.TenantID)
+	}
 	if err != nil {
-		return 0, err
+		return 0, translateError(err)
 	}
 	id, err := result.LastInsertId()
-	return int(id), err
+	return int(id), translateError(err)
 }
 
 // GetBrand retrieves a brand by ID
 func (d *DB) GetBrand(id int) (*models.Brand, error) {
-	var brand models.Brand
-	err := d.db.QueryRow("SELECT id, name, description, created_at, updated_at FROM brands WHERE id = ?", id).
-		Scan(&brand.ID, &brand.Name, &brand.Description, &brand.CreatedAt, &brand.UpdatedAt)
+	scope, args := d.brandScope()
+	brand, err := scanBrand(d.db.QueryRow("SELECT "+brandColumns+" FROM brands WHERE id = ?"+scope,
+		append([]interface{}{id}, args...)...))
 	if err != nil {
-		return nil, err
+		return nil, notFound(err, "brand", id)
 	}
-	return &brand, nil
+	return brand, nil
 }
 
-// ListBrands retrieves all brands
-func (d *DB) ListBrands() ([]models.Brand, error) {
-	rows, err := d.db.Query("SELECT id, name, description, created_at, updated_at FROM brands")
+// ListBrands retrieves a page of brands
+func (d *DB) ListBrands(filter models.BrandFilter) (*models.Page[models.Brand], error) {
+	p, err := newPage(filter.PageRequest, brandSorts)
 	if err != nil {
 		return nil, err
 	}
+
+	query, args := d.brandScope()
+	query = "SELECT " + brandColumns + " FROM brands WHERE 1 = 1" + query
+	if filter.Archived != nil {
+		if *filter.Archived {
+			query += " AND archived_at IS NOT NULL"
+		} else {
+			query += " AND archived_at IS NULL"
+		}
+	}
+	if filter.Search != "" {
+		query += " AND name LIKE ?"
+		args = append(args, containsPattern(filter.Search))
+	}
+	clause, pageArgs := p.clause()
+	query += clause
+	args = append(args, pageArgs...)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
 	defer rows.Close()
 
 	var brands []models.Brand
 	for rows.Next() {
-		var b models.Brand
-		if err := rows.Scan(&b.ID, &b.Name, &b.Description, &b.CreatedAt, &b.UpdatedAt); err != nil {
-			return nil, err
+		b, err := scanBrand(rows)
+		if err != nil {
+			return nil, translateError(err)
 		}
-		brands = append(brands, b)
+		brands = append(brands, *b)
 	}
-	return brands, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+
+	return paginate(p, brands, func(b models.Brand, column string) (interface{}, int) {
+		switch column {
+		case "name":
+			return b.Name, b.ID
+		case "created_at":
+			return b.CreatedAt, b.ID
+		}
+		return b.ID, b.ID
+	}), nil
 }
 
-// CreateVoucher creates a new voucher
+// CreateVoucher creates a new voucher. Its code is reserved in the same
+// transaction, so it cannot also be used by a voucher or a code pool. The
+// brand is locked first and must not be archived. For a tenant, brands of
+// other tenants are treated as missing.
 func (d *DB) CreateVoucher(voucher *models.Voucher) (int, error) {
-	query := `INSERT INTO vouchers (brand_id, code, name, description, points_cost, is_active, valid_until) 
-	         VALUES (?, ?, ?, ?, ?, ?, ?)`
-	result, err := d.db.Exec(query, voucher.BrandID, voucher.Code, voucher.Name,
-		voucher.Description, voucher.PointsCost, voucher.IsActive, voucher.ValidUntil)
+	tx, err := d.BeginTx()
+	if err != nil {
+		return 0, translateError(err)
+	}
+	defer tx.Rollback()
+
+	err = d.lockOpenBrand(tx, voucher.BrandID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: brand %d does not exist", ErrInvalidReference, voucher.BrandID)
+	}
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	err = reserveCodes(tx, []string{voucher.Code})
+	if isDuplicateEntry(err) {
+		return 0, d.codeTaken(voucher.Code)
+	}
 	if err != nil {
-		return 0, err
+		return 0, translateError(err)
+	}
+
+	query := `INSERT INTO vouchers (brand_id, code, name, description, points_cost, total_stock, remaining_stock, 
+	         per_customer_limit, limit_period, is_active, valid_from, valid_until) 
+	         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, voucher.BrandID, voucher.Code, voucher.Name,
+		voucher.Description, voucher.PointsCost, voucher.TotalStock, voucher.RemainingStock,
+		voucher.PerCustomerLimit, nullString(voucher.LimitPeriod), voucher.IsActive,
+		nullTime(voucher.ValidFrom), nullTime(voucher.ValidUntil))
+	if isDuplicateEntry(err) {
+		return 0, d.codeTaken(voucher.Code)
+	}
+	if isMissingReference(err) {
+		return 0, fmt.Errorf("%w: brand %d does not exist", ErrInvalidReference, voucher.BrandID)
+	}
+	if err != nil {
+		return 0, translateError(err)
 	}
 	id, err := result.LastInsertId()
-	return int(id), err
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return int(id), translateError(tx.Commit())
 }
 
-// GetVoucher retrieves a voucher by ID
+// GetVoucher retrieves a voucher by ID. Deleted vouchers are not found.
 func (d *DB) GetVoucher(id int) (*models.Voucher, error) {
-	var v models.Voucher
-	err := d.db.QueryRow(`SELECT id, brand_id, code, name, description, points_cost, 
-		is_active, valid_until, created_at, updated_at FROM vouchers WHERE id = ?`, id).
-		Scan(&v.ID, &v.BrandID, &v.Code, &v.Name, &v.Description, &v.PointsCost,
-			&v.IsActive, &v.ValidUntil, &v.CreatedAt, &v.UpdatedAt)
+	scope, args := d.voucherScope()
+	v, err := scanVoucher(d.db.QueryRow(`SELECT `+voucherColumns+`
+		FROM vouchers WHERE id = ? AND deleted_at IS NULL`+scope, append([]interface{}{id}, args...)...))
 	if err != nil {
-		return nil, err
+		return nil, notFound(err, "voucher", id)
 	}
 	return &v, nil
 }
 
-// ListVouchers retrieves all vouchers
-func (d *DB) ListVouchers() ([]models.Voucher, error) {
-	rows, err := d.db.Query(`SELECT id, brand_id, code, name, description, points_cost, 
-		is_active, valid_until, created_at, updated_at FROM vouchers`)
+// ListVouchers retrieves a page of the vouchers matching filter. Deleted
+// vouchers are left out.
+func (d *DB) ListVouchers(filter models.VoucherFilter) (*models.Page[models.Voucher], error) {
+	p, err := newPage(filter.PageRequest, voucherSorts)
 	if err != nil {
 		return nil, err
 	}
+
+	query, args := d.voucherScope()
+	query = `SELECT ` + voucherColumns + ` FROM vouchers WHERE deleted_at IS NULL` + query
+	if filter.BrandID != 0 {
+		query += " AND brand_id = ?"
+		args = append(args, filter.BrandID)
+	}
+	if filter.ExcludeExpired {
+		query += notExpired
+		args = append(args, time.Now())
+	}
+	if filter.Active != nil {
+		query += " AND is_active = ?"
+		args = append(args, *filter.Active)
+	}
+	if !filter.ExpiresBefore.IsZero() {
+		query += " AND valid_until < ?"
+		args = append(args, filter.ExpiresBefore)
+	}
+	if filter.MinPoints != nil {
+		query += " AND points_cost >= ?"
+		args = append(args, *filter.MinPoints)
+	}
+	if filter.MaxPoints != nil {
+		query += " AND points_cost <= ?"
+		args = append(args, *filter.MaxPoints)
+	}
+	if filter.Search != "" {
+		query += " AND name LIKE ?"
+		args = append(args, containsPattern(filter.Search))
+	}
+	clause, pageArgs := p.clause()
+	query += clause
+	args = append(args, pageArgs...)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
 	defer rows.Close()
 
 	var vouchers []models.Voucher
 	for rows.Next() {
-		var v models.Voucher
-		if err := rows.Scan(&v.ID, &v.BrandID, &v.Code, &v.Name, &v.Description, &v.PointsCost,
-			&v.IsActive, &v.ValidUntil, &v.CreatedAt, &v.UpdatedAt); err != nil {
-			return nil, err
+		v, err := scanVoucher(rows)
+		if err != nil {
+			return nil, translateError(err)
 		}
 		vouchers = append(vouchers, v)
 	}
-	return vouchers, rows.Err()
-}
-
-// GetCustomer retrieves a customer by ID
-func (d *DB) GetCustomer(id int) (*models.Customer, error) {
-	var c models.Customer
-	err := d.db.QueryRow("SELECT id, name, email, points_balance, created_at, updated_at FROM customers WHERE id = ?", id).
-		Scan(&c.ID, &c.Name, &c.Email, &c.PointsBalance, &c.CreatedAt, &c.UpdatedAt)
-	if err != nil {
-		return nil, err
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
 	}
-	return &c, nil
-}
 
-// CreateRedemption creates a new redemption
-func (d *DB) CreateRedemption(redemption *models.Redemption) (int, error) {
-	query := `INSERT INTO redemptions (customer_id, total_points_cost, status) VALUES (?, ?, ?)`
-	result, err := d.db.Exec(query, redemption.CustomerID, redemption.TotalPointsCost, redemption.Status)
-	if err != nil {
-		return 0, err
-	}
-	id, err := result.LastInsertId()
-	return int(id), err
+	return paginate(p, vouchers, func(v models.Voucher, column string) (interface{}, int) {
+		switch column {
+		case "name":
+			return v.Name, v.ID
+		case "points_cost":
+			return v.PointsCost, v.ID
+		case "created_at":
+			return v.CreatedAt, v.ID
+		}
+		return v.ID, v.ID
+	}), nil
 }
 
-// GetRedemption retrieves a redemption by ID
+// GetRedemption retrieves a redemption by ID along with its items
 func (d *DB) GetRedemption(id int) (*models.Redemption, error) {
 	var r models.Redemption
 	err := d.db.QueryRow(`SELECT id, customer_id, total_points_cost, status, created_at, updated_at 
 		FROM redemptions WHERE id = ?`, id).
 		Scan(&r.ID, &r.CustomerID, &r.TotalPointsCost, &r.Status, &r.CreatedAt, &r.UpdatedAt)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err, "redemption", id)
 	}
-	return &r, nil
-}
 
-// UpdateCustomerPoints updates a customer's points balance
-func (d *DB) UpdateCustomerPoints(customerID int, points int) error {
-	_, err := d.db.Exec("UPDATE customers SET points_balance = ? WHERE id = ?", points, customerID)
-	return err
+	items, err := d.getRedemptionItems([]int{r.ID})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	r.Items = items[r.ID]
+	if r.Items == nil {
+		r.Items = []models.RedemptionItem{}
+	}
+	return &r, nil
 }
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"voucher-api/internal/models"
+)
+
+// Kinds of value a list can be sorted by, so a cursor's value can be turned
+// back into a query argument of the right type
+const (
+	sortInt = iota
+	sortString
+	sortTime
+)
+
+// sortColumn is a column a list can be ordered by
+type sortColumn struct {
+	column string
+	kind   int
+}
+
+var brandSorts = map[string]sortColumn{
+	"id":         {"id", sortInt},
+	"name":       {"name", sortString},
+	"created_at": {"created_at", sortTime},
+}
+
+var voucherSorts = map[string]sortColumn{
+	"id":          {"id", sortInt},
+	"name":        {"name", sortString},
+	"points_cost": {"points_cost", sortInt},
+	"created_at":  {"created_at", sortTime},
+}
+
+var redemptionSorts = map[string]sortColumn{
+	"id":         {"id", sortInt},
+	"created_at": {"created_at", sortTime},
+}
+
+// cursor marks the last row of a page: its sort value and ID. The sort is
+// kept too so a cursor cannot be reused with a different order.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// page is the ordering and keyset condition for fetching one page of a list.
+// afterValue and afterID are the sort value and ID of the previous page's
+// last row, if there was a previous page.
+type page struct {
+	sort       string
+	column     sortColumn
+	descending bool
+	limit      int
+	after      bool
+	afterValue interface{}
+	afterID    int
+}
+
+// newPage checks a page request against the sorts a list supports
+func newPage(req models.PageRequest, sorts map[string]sortColumn) (*page, error) {
+	p := &page{sort: req.Sort, limit: req.Limit}
+	if p.sort == "" {
+		p.sort = "id"
+	}
+	if p.limit == 0 {
+		p.limit = models.DefaultPageSize
+	}
+
+	name := strings.TrimPrefix(p.sort, "-")
+	column, ok := sorts[name]
+	if !ok {
+		return nil, fmt.Errorf("sort %q: %w", req.Sort, models.ErrInvalidSort)
+	}
+	p.column = column
+	p.descending = name != p.sort
+
+	if req.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(req.Cursor)
+		if err != nil {
+			return nil, models.ErrInvalidCursor
+		}
+		var c cursor
+		if err := json.Unmarshal(raw, &c); err != nil || c.Sort != p.sort {
+			return nil, models.ErrInvalidCursor
+		}
+		value, err := parseSortValue(column.kind, c.Value)
+		if err != nil {
+			return nil, models.ErrInvalidCursor
+		}
+		p.after, p.afterValue, p.afterID = true, value, c.ID
+	}
+	return p, nil
+}
+
+// clause returns the condition that skips rows up to the cursor, the ORDER BY
+// and the LIMIT, with their arguments. One row more than the page size is
+// fetched to tell whether another page follows.
+func (p *page) clause() (string, []interface{}) {
+	dir, cmp := "ASC", ">"
+	if p.descending {
+		dir, cmp = "DESC", "<"
+	}
+
+	var query string
+	var args []interface{}
+	if p.after {
+		if p.column.column == "id" {
+			query = " AND id " + cmp + " ?"
+			args = append(args, p.afterID)
+		} else {
+			query = fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", p.column.column, cmp)
+			args = append(args, p.afterValue, p.afterValue, p.afterID)
+		}
+	}
+
+	if p.column.column == "id" {
+		query += " ORDER BY id " + dir
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, id %s", p.column.column, dir, dir)
+	}
+	query += " LIMIT ?"
+	args = append(args, p.limit+1)
+	return query, args
+}
+
+// parseSortValue converts a cursor's sort value back to its column's type
+func parseSortValue(kind int, s string) (interface{}, error) {
+	switch kind {
+	case sortInt:
+		return strconv.Atoi(s)
+	case sortTime:
+		return time.Parse(time.RFC3339Nano, s)
+	default:
+		return s, nil
+	}
+}
+
+// formatSortValue formats a row's sort value for a cursor
+func formatSortValue(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// paginate trims the extra row fetched by clause and, when there was one, sets
+// the cursor for the next page from the last row kept. key returns a row's
+// value of the sort column and its ID.
+func paginate[T any](p *page, rows []T, key func(row T, column string) (interface{}, int)) *models.Page[T] {
+	result := &models.Page[T]{Data: rows}
+	if result.Data == nil {
+		result.Data = []T{}
+	}
+	if len(rows) <= p.limit {
+		return result
+	}
+
+	result.Data = rows[:p.limit]
+	value, id := key(result.Data[p.limit-1], p.column.column)
+	raw, _ := json.Marshal(cursor{Sort: p.sort, Value: formatSortValue(value), ID: id})
+	result.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+	return result
+}
+
+// containsPattern builds a LIKE pattern matching s anywhere, with LIKE's
+// wildcards in s matched literally
+func containsPattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
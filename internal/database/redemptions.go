@@ -0,0 +1,359 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+	"voucher-api/internal/models"
+)
+
+// CreateRedemption records a redemption together with its items, takes the
+// items from voucher stock, assigns pool codes to them and debits the total
+// cost to the customer's points ledger in a single transaction. The customer
+// and voucher rows are locked while the customer's status and balance and
+// the vouchers' prices, stock and per-customer limits are re-read, so a
+// failure at any step leaves neither a dangling redemption nor a partial
+// deduction. Pool codes stay assigned if the redemption is later cancelled,
+// since the customer may already have seen them. On success the redemption
+// carries its ID, timestamps, item IDs, the prices charged and any assigned
+// codes, so callers need not read it back.
+func (d *DB) CreateRedemption(redemption *models.Redemption) (int, error) {
+	tx, err := d.BeginTx()
+	if err != nil {
+		return 0, translateError(err)
+	}
+	defer tx.Rollback()
+
+	balance, active, err := lockCustomerBalance(tx, redemption.CustomerID)
+	if err != nil {
+		return 0, notFound(err, "customer", redemption.CustomerID)
+	}
+	if !active {
+		return 0, models.ErrCustomerInactive
+	}
+
+	// Prices are read again under the voucher locks, so the customer pays,
+	// and the items record, the price at the time of the redemption even if
+	// it was edited after the handler read it
+	pooled, err := reserveVouchers(tx, redemption.CustomerID, redemption.Items, time.Now())
+	if err != nil {
+		return 0, translateError(err)
+	}
+	redemption.TotalPointsCost = 0
+	for _, item := range redemption.Items {
+		redemption.TotalPointsCost += item.PointsCost * item.Quantity
+	}
+	if balance < redemption.TotalPointsCost {
+		return 0, models.ErrInsufficientPoints
+	}
+
+	id, err := insertRedemption(tx, redemption)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	if err := assignCodes(tx, redemption.Items, pooled); err != nil {
+		return 0, translateError(err)
+	}
+
+	// Free baskets move no points, so like zero refunds they are not posted
+	if redemption.TotalPointsCost > 0 {
+		err = postLedgerEntry(tx, &models.PointsLedgerEntry{
+			CustomerID:    redemption.CustomerID,
+			EntryType:     models.LedgerRedeem,
+			Amount:        -redemption.TotalPointsCost,
+			ReferenceType: "redemption",
+			ReferenceID:   strconv.Itoa(id),
+		})
+		if err != nil {
+			return 0, notFound(err, "customer", redemption.CustomerID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, translateError(err)
+	}
+
+	redemption.ID = id
+	return id, nil
+}
+
+// ListCustomerRedemptions retrieves a page of a customer's redemptions with
+// their items, newest first unless the filter sorts otherwise
+func (d *DB) ListCustomerRedemptions(customerID int, filter models.RedemptionFilter) (*models.Page[models.Redemption], error) {
+	if filter.Sort == "" {
+		filter.Sort = "-id"
+	}
+	p, err := newPage(filter.PageRequest, redemptionSorts)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, customer_id, total_points_cost, status, created_at, updated_at
+		FROM redemptions WHERE customer_id = ?`
+	args := []interface{}{customerID}
+	if filter.Status != "" {
+		query += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+	if !filter.From.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.To)
+	}
+	clause, pageArgs := p.clause()
+	query += clause
+	args = append(args, pageArgs...)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	var redemptions []models.Redemption
+	for rows.Next() {
+		var r models.Redemption
+		if err := rows.Scan(&r.ID, &r.CustomerID, &r.TotalPointsCost, &r.Status, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, translateError(err)
+		}
+		redemptions = append(redemptions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+
+	result := paginate(p, redemptions, func(r models.Redemption, column string) (interface{}, int) {
+		if column == "created_at" {
+			return r.CreatedAt, r.ID
+		}
+		return r.ID, r.ID
+	})
+	if len(result.Data) == 0 {
+		return result, nil
+	}
+
+	ids := make([]int, len(result.Data))
+	for i, r := range result.Data {
+		ids[i] = r.ID
+	}
+	items, err := d.getRedemptionItems(ids)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	for i := range result.Data {
+		result.Data[i].Items = items[result.Data[i].ID]
+		if result.Data[i].Items == nil {
+			result.Data[i].Items = []models.RedemptionItem{}
+		}
+	}
+	return result, nil
+}
+
+// redemptionTransitions lists the statuses a redemption may move to from its
+// current status. A completed redemption can still be cancelled and refunded;
+// cancelled and failed redemptions are final.
+var redemptionTransitions = map[string][]string{
+	models.StatusPending:   {models.StatusCompleted, models.StatusCancelled, models.StatusFailed},
+	models.StatusCompleted: {models.StatusCancelled},
+}
+
+// canTransition reports whether a redemption may move from one status to another
+func canTransition(from, to string) bool {
+	for _, next := range redemptionTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionRedemption moves a redemption to a new status. Cancelling or
+// failing a redemption returns its vouchers to stock and refunds its points
+// in the same transaction.
+func (d *DB) TransitionRedemption(id int, status string) (*models.Redemption, error) {
+	tx, err := d.BeginTx()
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer tx.Rollback()
+
+	var customerID, total int
+	var current string
+	err = tx.QueryRow("SELECT customer_id, total_points_cost, status FROM redemptions WHERE id = ? FOR UPDATE", id).
+		Scan(&customerID, &total, &current)
+	if err != nil {
+		return nil, notFound(err, "redemption", id)
+	}
+	if !canTransition(current, status) {
+		return nil, models.ErrInvalidTransition
+	}
+
+	// Lock the customer before the vouchers, in the same order as
+	// CreateRedemption. releaseStock then locks the vouchers in ID order, as
+	// reserveVouchers does, so neither a redemption of the same customer nor
+	// one of another customer on the same vouchers can deadlock with this.
+	refund := status == models.StatusCancelled || status == models.StatusFailed
+	if refund {
+		if _, _, err := lockCustomerBalance(tx, customerID); err != nil {
+			return nil, notFound(err, "customer", customerID)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE redemptions SET status = ? WHERE id = ?", status, id); err != nil {
+		return nil, translateError(err)
+	}
+
+	if refund {
+		if err := releaseStock(tx, id); err != nil {
+			return nil, translateError(err)
+		}
+	}
+	if refund && total > 0 {
+		err = postLedgerEntry(tx, &models.PointsLedgerEntry{
+			CustomerID:    customerID,
+			EntryType:     models.LedgerRefund,
+			Amount:        total,
+			ReferenceType: "redemption",
+			ReferenceID:   strconv.Itoa(id),
+			Description:   "Redemption " + status,
+		})
+		if err != nil {
+			return nil, notFound(err, "customer", customerID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, translateError(err)
+	}
+	return d.GetRedemption(id)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// deductPoints decrements a balance only when it is large enough to cover the
+// deduction. When no row changes, the customer either does not exist or
+// cannot afford it; the two cases are told apart with a follow-up lookup.
+func deductPoints(q querier, customerID int, points int) error {
+	if points == 0 {
+		return nil
+	}
+
+	result, err := q.Exec(`UPDATE customers SET points_balance = points_balance - ?
+		WHERE id = ? AND points_balance >= ?`, points, customerID, points)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	var exists int
+	if err := q.QueryRow("SELECT 1 FROM customers WHERE id = ?", customerID).Scan(&exists); err != nil {
+		return err
+	}
+	return models.ErrInsufficientPoints
+}
+
+// lockCustomerBalance reads a customer's balance and whether they are active,
+// and holds a row lock on them until the transaction ends
+func lockCustomerBalance(tx *sql.Tx, customerID int) (balance int, active bool, err error) {
+	err = tx.QueryRow("SELECT points_balance, is_active FROM customers WHERE id = ? FOR UPDATE", customerID).
+		Scan(&balance, &active)
+	return balance, active, err
+}
+
+// insertRedemption writes the redemption row and each of its items
+func insertRedemption(tx *sql.Tx, redemption *models.Redemption) (int, error) {
+	result, err := tx.Exec(`INSERT INTO redemptions (customer_id, total_points_cost, status) VALUES (?, ?, ?)`,
+		redemption.CustomerID, redemption.TotalPointsCost, redemption.Status)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	err = tx.QueryRow("SELECT created_at, updated_at FROM redemptions WHERE id = ?", id).
+		Scan(&redemption.CreatedAt, &redemption.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range redemption.Items {
+		item := &redemption.Items[i]
+		result, err := tx.Exec(`INSERT INTO redemption_items (redemption_id, voucher_id, quantity, points_cost)
+			VALUES (?, ?, ?, ?)`, id, item.VoucherID, item.Quantity, item.PointsCost)
+		if err != nil {
+			return 0, err
+		}
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		item.ID = int(itemID)
+		item.RedemptionID = int(id)
+		item.CreatedAt = redemption.CreatedAt
+	}
+
+	return int(id), nil
+}
+
+// getRedemptionItems loads the items of the given redemptions, keyed by
+// redemption ID, with the name of each voucher, the unit points cost it had at
+// the time it was redeemed and any codes assigned to them
+func (d *DB) getRedemptionItems(redemptionIDs []int) (map[int][]models.RedemptionItem, error) {
+	inList, args := intList(redemptionIDs)
+	rows, err := d.db.Query(`SELECT ri.id, ri.redemption_id, ri.voucher_id, v.name, ri.quantity, ri.points_cost, ri.created_at
+		FROM redemption_items ri JOIN vouchers v ON v.id = ri.voucher_id
+		WHERE ri.redemption_id IN (`+inList+`) ORDER BY ri.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.RedemptionItem
+	for rows.Next() {
+		var item models.RedemptionItem
+		if err := rows.Scan(&item.ID, &item.RedemptionID, &item.VoucherID, &item.VoucherName, &item.Quantity,
+			&item.PointsCost, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	codes, err := d.getRedemptionCodes(redemptionIDs)
+	if err != nil {
+		return nil, err
+	}
+	byRedemption := map[int][]models.RedemptionItem{}
+	for _, item := range items {
+		item.Codes = codes[item.ID]
+		byRedemption[item.RedemptionID] = append(byRedemption[item.RedemptionID], item)
+	}
+	return byRedemption, nil
+}
+
+// intList returns a placeholder list for an IN clause and its arguments
+func intList(values []int) (string, []interface{}) {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", "), args
+}
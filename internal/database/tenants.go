@@ -0,0 +1,86 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"voucher-api/internal/models"
+)
+
+// ForTenant returns a DB whose brand and voucher queries only see the brands
+// of one tenant and the vouchers of those brands. Other tenants' records are
+// reported as not found, exactly like records that do not exist. Brands
+// created through it belong to the tenant. Tenant zero sees everything.
+func (d *DB) ForTenant(tenantID int) *DB {
+	return &DB{db: d.db, tenantID: tenantID}
+}
+
+// brandScope returns the condition, with its arguments, that limits a query
+// on brands to the tenant's
+func (d *DB) brandScope() (string, []interface{}) {
+	if d.tenantID == 0 {
+		return "", nil
+	}
+	return " AND tenant_id = ?", []interface{}{d.tenantID}
+}
+
+// voucherScope returns the condition, with its arguments, that limits a query
+// on vouchers to those of the tenant's brands
+func (d *DB) voucherScope() (string, []interface{}) {
+	if d.tenantID == 0 {
+		return "", nil
+	}
+	return " AND brand_id IN (SELECT id FROM brands WHERE tenant_id = ?)", []interface{}{d.tenantID}
+}
+
+// codeTaken reports that a voucher code is already reserved. Codes are unique
+// across tenants, so for a tenant the message does not confirm which code
+// another tenant uses.
+func (d *DB) codeTaken(code string) error {
+	if d.tenantID != 0 {
+		return fmt.Errorf("%w: voucher code is not available", ErrConflict)
+	}
+	return fmt.Errorf("%w: voucher code %q already exists", ErrConflict, code)
+}
+
+// CreateTenant creates a new tenant
+func (d *DB) CreateTenant(tenant *models.Tenant) error {
+	result, err := d.db.Exec("INSERT INTO tenants (name) VALUES (?)", tenant.Name)
+	if err != nil {
+		return translateError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return translateError(err)
+	}
+
+	err = d.db.QueryRow("SELECT id, name, created_at FROM tenants WHERE id = ?", id).
+		Scan(&tenant.ID, &tenant.Name, &tenant.CreatedAt)
+	return notFound(err, "tenant", int(id))
+}
+
+// ListTenants retrieves all tenants
+func (d *DB) ListTenants() ([]models.Tenant, error) {
+	rows, err := d.db.Query("SELECT id, name, created_at FROM tenants ORDER BY id")
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	tenants := []models.Tenant{}
+	for rows.Next() {
+		var t models.Tenant
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt); err != nil {
+			return nil, translateError(err)
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, translateError(rows.Err())
+}
+
+// nullInt stores a nil ID as NULL
+func nullInt(id *int) sql.NullInt64 {
+	if id == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*id), Valid: true}
+}
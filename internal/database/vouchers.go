@@ -0,0 +1,342 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+	"voucher-api/internal/models"
+)
+
+// voucherColumns lists the columns scanVoucher expects, in order
+const voucherColumns = `id, brand_id, code, name, description, points_cost, total_stock, 
+		       remaining_stock, per_customer_limit, limit_period, code_pool, is_active, valid_from, 
+		       valid_until, created_at, updated_at`
+
+// notExpired is appended to a voucher WHERE clause, with the current time as
+// its argument, to drop vouchers whose expiry has passed
+const notExpired = ` AND (valid_until IS NULL OR valid_until > ?)`
+
+// scanVoucher reads a row selected with voucherColumns. Validity dates that
+// are not set come back as the zero time.
+func scanVoucher(s scanner) (models.Voucher, error) {
+	var v models.Voucher
+	var period sql.NullString
+	var validFrom, validUntil sql.NullTime
+	err := s.Scan(&v.ID, &v.BrandID, &v.Code, &v.Name, &v.Description, &v.PointsCost, &v.TotalStock,
+		&v.RemainingStock, &v.PerCustomerLimit, &period, &v.CodePool, &v.IsActive, &validFrom, &validUntil,
+		&v.CreatedAt, &v.UpdatedAt)
+	v.LimitPeriod = period.String
+	v.ValidFrom = validFrom.Time
+	v.ValidUntil = validUntil.Time
+	return v, err
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// UpdateVoucher saves a voucher's editable fields. The brand cannot change.
+// setActive reports whether the caller chose IsActive rather than keeping it;
+// only then is IsActive saved and, like SetVoucherActive, the choice
+// overrides archiving, though a voucher cannot be switched on under an
+// archived brand. The brand is locked before the voucher, in the same order
+// as ArchiveBrand. When the code changes, the old one is released and the new
+// one reserved in the same transaction. setStock reports whether the caller
+// changed TotalStock; the remaining stock then moves by as much as the total
+// did, or starts at the full total for a voucher that had no limit, and is
+// set on voucher.
+func (d *DB) UpdateVoucher(voucher *models.Voucher, setActive, setStock bool) error {
+	tx, err := d.BeginTx()
+	if err != nil {
+		return translateError(err)
+	}
+	defer tx.Rollback()
+
+	archivedAt, err := d.lockBrand(tx, voucher.BrandID)
+	if err != nil {
+		return notFound(err, "voucher", voucher.ID)
+	}
+	if archivedAt.Valid && setActive && voucher.IsActive {
+		return models.ErrBrandArchived
+	}
+
+	scope, args := d.voucherScope()
+	var code string
+	err = tx.QueryRow("SELECT code FROM vouchers WHERE id = ? AND brand_id = ? AND deleted_at IS NULL"+scope+" FOR UPDATE",
+		append([]interface{}{voucher.ID, voucher.BrandID}, args...)...).Scan(&code)
+	if err != nil {
+		return notFound(err, "voucher", voucher.ID)
+	}
+
+	// The old code is released first: codes compare case-insensitively, so a
+	// change of case alone would otherwise collide with its own reservation
+	if voucher.Code != code {
+		if _, err := tx.Exec("DELETE FROM reserved_codes WHERE code = ?", code); err != nil {
+			return translateError(err)
+		}
+		err = reserveCodes(tx, []string{voucher.Code})
+		if isDuplicateEntry(err) {
+			return d.codeTaken(voucher.Code)
+		}
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	// is_active is only written when the caller chose it, so an edit cannot
+	// undo an archive that ran after the caller read the voucher
+	set := ""
+	updateArgs := []interface{}{voucher.Code, voucher.Name, voucher.Description, voucher.PointsCost,
+		voucher.PerCustomerLimit, nullString(voucher.LimitPeriod), nullTime(voucher.ValidFrom),
+		nullTime(voucher.ValidUntil)}
+	if setActive {
+		set += ", is_active = ?, archived_with_brand = false"
+		updateArgs = append(updateArgs, voucher.IsActive)
+	}
+	if setStock {
+		if err := lockedRemainingStock(tx, voucher); err != nil {
+			return err
+		}
+		set += ", total_stock = ?, remaining_stock = ?"
+		updateArgs = append(updateArgs, voucher.TotalStock, voucher.RemainingStock)
+	}
+	_, err = tx.Exec(`UPDATE vouchers SET code = ?, name = ?, description = ?, points_cost = ?,
+		per_customer_limit = ?, limit_period = ?, valid_from = ?, valid_until = ?`+set+`
+		WHERE id = ?`, append(updateArgs, voucher.ID)...)
+	if isDuplicateEntry(err) {
+		return d.codeTaken(voucher.Code)
+	}
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(tx.Commit())
+}
+
+// lockedRemainingStock sets voucher.RemainingStock for its new TotalStock
+// from the stock stored for it, which the caller must have locked. Units
+// already taken stay taken, so a total below them is rejected.
+func lockedRemainingStock(tx *sql.Tx, voucher *models.Voucher) error {
+	if voucher.TotalStock == nil {
+		voucher.RemainingStock = nil
+		return nil
+	}
+
+	var total, remaining sql.NullInt64
+	err := tx.QueryRow("SELECT total_stock, remaining_stock FROM vouchers WHERE id = ?", voucher.ID).
+		Scan(&total, &remaining)
+	if err != nil {
+		return notFound(err, "voucher", voucher.ID)
+	}
+	left := *voucher.TotalStock
+	if total.Valid {
+		left = int(remaining.Int64) + *voucher.TotalStock - int(total.Int64)
+	}
+	if left < 0 {
+		return fmt.Errorf("voucher %d: %w", voucher.ID, models.ErrInvalidStock)
+	}
+	voucher.RemainingStock = &left
+	return nil
+}
+
+// SetVoucherActive enables or disables redeeming a voucher. An explicit change
+// overrides archiving, so restoring the brand later leaves the voucher alone.
+// A voucher is only switched on while its brand, locked first as in
+// ArchiveBrand, is not archived.
+func (d *DB) SetVoucherActive(id int, active bool) error {
+	tx, err := d.BeginTx()
+	if err != nil {
+		return translateError(err)
+	}
+	defer tx.Rollback()
+
+	scope, args := d.voucherScope()
+	if active {
+		var brandID int
+		err := tx.QueryRow("SELECT brand_id FROM vouchers WHERE id = ? AND deleted_at IS NULL"+scope,
+			append([]interface{}{id}, args...)...).Scan(&brandID)
+		if err != nil {
+			return notFound(err, "voucher", id)
+		}
+		if err := d.lockOpenBrand(tx, brandID); err != nil {
+			return notFound(err, "voucher", id)
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE vouchers SET is_active = ?, archived_with_brand = false
+		WHERE id = ? AND deleted_at IS NULL`+scope, append([]interface{}{active, id}, args...)...)
+	if err != nil {
+		return translateError(err)
+	}
+	return translateError(tx.Commit())
+}
+
+// DeleteVoucher soft-deletes a voucher. The row is kept, and stays
+// deactivated, so redemptions that reference it keep their history; it just
+// disappears from lookups and lists. Its code stays reserved.
+func (d *DB) DeleteVoucher(id int) error {
+	scope, args := d.voucherScope()
+	result, err := d.db.Exec(`UPDATE vouchers SET is_active = false, deleted_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND deleted_at IS NULL`+scope, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return translateError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return translateError(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("voucher %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// RestockVoucher adds quantity units to a voucher's total and remaining
+// stock. Vouchers without a stock limit cannot be restocked.
+func (d *DB) RestockVoucher(id int, quantity int) (*models.Voucher, error) {
+	scope, args := d.voucherScope()
+	result, err := d.db.Exec(`UPDATE vouchers SET total_stock = total_stock + ?, remaining_stock = remaining_stock + ?
+		WHERE id = ? AND total_stock IS NOT NULL AND deleted_at IS NULL`+scope,
+		append([]interface{}{quantity, quantity, id}, args...)...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	voucher, err := d.GetVoucher(id)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("voucher %d: %w", id, models.ErrStockNotLimited)
+	}
+	return voucher, nil
+}
+
+// reserveVouchers checks that each voucher in a basket can still be redeemed
+// at now, then checks it against its stock and the customer's redemption
+// limit, and takes the basket's units from stock. Each item's points cost is
+// set to the voucher's current price. Each voucher row is locked before it is
+// read, in ID order so that concurrent redemptions of the same vouchers
+// cannot deadlock. The caller must already hold the customer's row lock so
+// that the customer's prior redemptions cannot change while they are
+// counted. It returns the IDs of the vouchers that hand out codes from a
+// pool.
+func reserveVouchers(tx *sql.Tx, customerID int, items []models.RedemptionItem, now time.Time) (map[int]bool, error) {
+	quantities := map[int]int{}
+	var ids []int
+	for _, item := range items {
+		if quantities[item.VoucherID] == 0 {
+			ids = append(ids, item.VoucherID)
+		}
+		quantities[item.VoucherID] += item.Quantity
+	}
+	sort.Ints(ids)
+
+	pooled := map[int]bool{}
+	for _, id := range ids {
+		var v models.Voucher
+		var period sql.NullString
+		var validFrom, validUntil sql.NullTime
+		err := tx.QueryRow(`SELECT points_cost, remaining_stock, per_customer_limit, limit_period, code_pool,
+			is_active, valid_from, valid_until FROM vouchers WHERE id = ? FOR UPDATE`, id).
+			Scan(&v.PointsCost, &v.RemainingStock, &v.PerCustomerLimit, &period, &v.CodePool, &v.IsActive,
+				&validFrom, &validUntil)
+		if err != nil {
+			return nil, notFound(err, "voucher", id)
+		}
+		v.LimitPeriod = period.String
+		v.ValidFrom = validFrom.Time
+		v.ValidUntil = validUntil.Time
+		if v.CodePool {
+			pooled[id] = true
+		}
+		for i := range items {
+			if items[i].VoucherID == id {
+				items[i].PointsCost = v.PointsCost
+			}
+		}
+
+		// Checked by the handler already, but the voucher may have been
+		// deactivated, archived or expired since
+		if err := v.CheckRedeemable(now); err != nil {
+			return nil, fmt.Errorf("voucher %d: %w", id, err)
+		}
+
+		if !v.InStock(quantities[id]) {
+			return nil, fmt.Errorf("voucher %d: %w", id, models.ErrOutOfStock)
+		}
+		if v.PerCustomerLimit != nil {
+			prior, err := countRedeemedUnits(tx, customerID, id, models.LimitWindowStart(v.LimitPeriod, now))
+			if err != nil {
+				return nil, err
+			}
+			if !v.AllowsQuantity(prior, quantities[id]) {
+				return nil, fmt.Errorf("voucher %d: %w", id, models.ErrLimitReached)
+			}
+		}
+		if v.RemainingStock != nil {
+			if _, err := tx.Exec("UPDATE vouchers SET remaining_stock = remaining_stock - ? WHERE id = ?",
+				quantities[id], id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return pooled, nil
+}
+
+// countRedeemedUnits counts the units of a voucher a customer has redeemed
+// since the given time, or ever when since is zero. Cancelled and failed
+// redemptions do not count.
+func countRedeemedUnits(q querier, customerID, voucherID int, since time.Time) (int, error) {
+	query := `SELECT COALESCE(SUM(ri.quantity), 0) FROM redemption_items ri
+		JOIN redemptions r ON r.id = ri.redemption_id
+		WHERE r.customer_id = ? AND ri.voucher_id = ? AND r.status NOT IN (?, ?)`
+	args := []interface{}{customerID, voucherID, models.StatusCancelled, models.StatusFailed}
+	if !since.IsZero() {
+		query += " AND r.created_at >= ?"
+		args = append(args, since)
+	}
+
+	var n int
+	err := q.QueryRow(query, args...).Scan(&n)
+	return n, err
+}
+
+// releaseStock returns the stock a redemption reserved to its vouchers. The
+// vouchers are updated one at a time in ID order, the order reserveVouchers
+// locks them in, so a release and a redemption of the same vouchers cannot
+// deadlock.
+func releaseStock(tx *sql.Tx, redemptionID int) error {
+	rows, err := tx.Query(`SELECT voucher_id, SUM(quantity) FROM redemption_items
+		WHERE redemption_id = ? GROUP BY voucher_id ORDER BY voucher_id`, redemptionID)
+	if err != nil {
+		return err
+	}
+	var ids, quantities []int
+	for rows.Next() {
+		var id, quantity int
+		if err := rows.Scan(&id, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+		quantities = append(quantities, quantity)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		if _, err := tx.Exec(`UPDATE vouchers SET remaining_stock = remaining_stock + ?
+			WHERE id = ? AND remaining_stock IS NOT NULL`, quantities[i], id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
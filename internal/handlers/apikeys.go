@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"voucher-api/internal/auth"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateAPIKey handles issuing an API key. The key itself is only part of
+// this response; afterwards just its prefix can be seen.
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	key, err := auth.GenerateKey()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	issued := &models.IssuedAPIKey{
+		APIKey: models.APIKey{
+			TenantID: req.TenantID,
+			Name:     req.Name,
+			Prefix:   auth.DisplayPrefix(key),
+			Scopes:   req.Scopes,
+		},
+		Key: key,
+	}
+	if err := h.db.CreateAPIKey(&issued.APIKey, auth.HashKey(key)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(issued)
+}
+
+// ListAPIKeys handles retrieving all API keys, without the keys themselves
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.db.ListAPIKeys()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeAPIKey handles revoking an API key
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid API key ID"))
+		return
+	}
+
+	if err := h.db.RevokeAPIKey(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
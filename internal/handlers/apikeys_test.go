@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"voucher-api/internal/auth"
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	mockDB := new(MockDB)
+	var storedHash string
+	mockDB.On("CreateAPIKey", mock.MatchedBy(func(k *models.APIKey) bool {
+		return k.Name == "pos" && strings.HasPrefix(k.Prefix, "vk_")
+	}), mock.AnythingOfType("string")).
+		Run(func(args mock.Arguments) {
+			args.Get(0).(*models.APIKey).ID = 4
+			storedHash = args.String(1)
+		}).
+		Return(nil)
+
+	router := chi.NewRouter()
+	router.Post("/api-keys", NewHandler(mockDB).CreateAPIKey)
+
+	body := `{"name":"pos","scopes":["redeem","read"]}`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api-keys", bytes.NewBufferString(body)))
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var issued models.IssuedAPIKey
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&issued))
+	assert.Equal(t, 4, issued.ID)
+	assert.Equal(t, []string{"redeem", "read"}, issued.Scopes)
+	assert.True(t, strings.HasPrefix(issued.Key, issued.Prefix))
+	// Only the hash of the key is stored
+	assert.Equal(t, auth.HashKey(issued.Key), storedHash)
+	mockDB.AssertExpectations(t)
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	mockDB := new(MockDB)
+	router := chi.NewRouter()
+	router.Post("/api-keys", NewHandler(mockDB).CreateAPIKey)
+
+	body := `{"name":"","scopes":["read","owner"]}`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api-keys", bytes.NewBufferString(body)))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var resp struct {
+		Error struct {
+			Details []models.FieldError `json:"details"`
+		} `json:"error"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	if assert.Len(t, resp.Error.Details, 2) {
+		assert.Equal(t, "name", resp.Error.Details[0].Field)
+		assert.Equal(t, "scopes[1]", resp.Error.Details[1].Field)
+	}
+	mockDB.AssertNotCalled(t, "CreateAPIKey", mock.Anything, mock.Anything)
+}
+
+func TestCreateAPIKeyTenantScopes(t *testing.T) {
+	mockDB := new(MockDB)
+	router := chi.NewRouter()
+	router.Post("/api-keys", NewHandler(mockDB).CreateAPIKey)
+
+	body := `{"name":"acme","tenant_id":3,"scopes":["read","redeem"]}`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api-keys", bytes.NewBufferString(body)))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var resp struct {
+		Error struct {
+			Details []models.FieldError `json:"details"`
+		} `json:"error"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	if assert.Len(t, resp.Error.Details, 1) {
+		assert.Equal(t, "scopes[1]", resp.Error.Details[0].Field)
+		assert.Equal(t, models.ErrTenantScope.Error(), resp.Error.Details[0].Message)
+	}
+	mockDB.AssertNotCalled(t, "CreateAPIKey", mock.Anything, mock.Anything)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		setupMock  func(*MockDB)
+		wantStatus int
+	}{
+		{
+			name: "revoked",
+			id:   "4",
+			setupMock: func(m *MockDB) {
+				m.On("RevokeAPIKey", 4).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "unknown or already revoked",
+			id:   "9",
+			setupMock: func(m *MockDB) {
+				m.On("RevokeAPIKey", 9).Return(fmt.Errorf("API key 9: %w", database.ErrNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid ID",
+			id:         "four",
+			setupMock:  func(m *MockDB) {},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			router := chi.NewRouter()
+			router.Delete("/api-keys/{id}", NewHandler(mockDB).RevokeAPIKey)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api-keys/"+tt.id, nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
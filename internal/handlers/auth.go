@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"voucher-api/internal/auth"
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+)
+
+// APIKeyHeader is the request header clients send their API key in
+const APIKeyHeader = "X-API-Key"
+
+// SetBootstrapKey sets an admin key that is accepted without being stored,
+// so the first real keys can be issued on a fresh database. An empty key
+// disables it.
+func (h *Handler) SetBootstrapKey(key string) {
+	h.bootstrapKeyHash = ""
+	if key != "" {
+		h.bootstrapKeyHash = auth.HashKey(key)
+	}
+}
+
+// SetTokenVerifier lets customers authenticate with bearer tokens checked by
+// v. Without one, only API keys are accepted.
+func (h *Handler) SetTokenVerifier(v *auth.TokenVerifier) {
+	h.tokens = v
+}
+
+// Authenticate identifies the client from its API key, or from a customer's
+// bearer token, and stores it in the request context for RequireScope.
+// Requests without valid credentials are rejected.
+func (h *Handler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var principal *auth.Principal
+		var err error
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			principal, err = h.principalForKey(key)
+		} else if token, ok := bearerToken(r); ok && h.tokens != nil && h.tokens.Enabled() {
+			principal, err = h.principalForToken(token)
+		} else {
+			err = auth.ErrMissingCredentials
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+	})
+}
+
+// bearerToken returns the token from an Authorization: Bearer header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// principalForToken verifies a customer's bearer token
+func (h *Handler) principalForToken(token string) (*auth.Principal, error) {
+	claims, err := h.tokens.Verify(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Principal{
+		CustomerID: claims.CustomerID,
+		Name:       "customer " + strconv.Itoa(claims.CustomerID),
+		Scopes:     []string{models.ScopeCustomer},
+	}, nil
+}
+
+// principalForKey looks up the client an API key belongs to
+func (h *Handler) principalForKey(key string) (*auth.Principal, error) {
+	hash := auth.HashKey(key)
+	if h.bootstrapKeyHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(h.bootstrapKeyHash)) == 1 {
+		return &auth.Principal{Name: "bootstrap", Scopes: []string{models.ScopeAdmin}}, nil
+	}
+
+	apiKey, err := h.db.GetAPIKeyByHash(hash)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, auth.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	principal := &auth.Principal{KeyID: apiKey.ID, Name: apiKey.Name, Scopes: apiKey.Scopes}
+	if apiKey.TenantID != nil {
+		// Without a way to scope queries the key would see every tenant
+		if h.forTenant == nil {
+			return nil, fmt.Errorf("API key %d belongs to tenant %d but tenant scoping is not set up", apiKey.ID, *apiKey.TenantID)
+		}
+		principal.TenantID = *apiKey.TenantID
+	}
+	return principal, nil
+}
+
+// RequireScope only lets through requests whose client was granted one of
+// scopes
+func (h *Handler) RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
+			if !ok {
+				writeError(w, r, auth.ErrMissingCredentials)
+				return
+			}
+			for _, scope := range scopes {
+				if principal.HasScope(scope) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			writeError(w, r, auth.ErrForbidden)
+		})
+	}
+}
+
+// RequirePlatform only lets through requests from the platform's own clients.
+// Tenant keys are limited to their brands and vouchers, so customers,
+// redemptions, points and the admin endpoints are closed to them.
+func (h *Handler) RequirePlatform(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			writeError(w, r, auth.ErrMissingCredentials)
+			return
+		}
+		if principal.TenantID != 0 {
+			writeError(w, r, auth.ErrForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
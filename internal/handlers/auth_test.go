@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"voucher-api/internal/auth"
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	const bootstrapKey = "vk_bootstrap"
+
+	tests := []struct {
+		name       string
+		key        string
+		scope      string
+		setupMock  func(*MockDB)
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "missing key",
+			scope:      models.ScopeRead,
+			setupMock:  func(m *MockDB) {},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   CodeUnauthorized,
+		},
+		{
+			name:  "unknown or revoked key",
+			key:   "vk_revoked",
+			scope: models.ScopeRead,
+			setupMock: func(m *MockDB) {
+				m.On("GetAPIKeyByHash", auth.HashKey("vk_revoked")).Return(nil, database.ErrNotFound)
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   CodeUnauthorized,
+		},
+		{
+			name:  "key with the scope",
+			key:   "vk_pos",
+			scope: models.ScopeRedeem,
+			setupMock: func(m *MockDB) {
+				m.On("GetAPIKeyByHash", auth.HashKey("vk_pos")).
+					Return(&models.APIKey{ID: 3, Name: "pos", Scopes: []string{models.ScopeRedeem, models.ScopeRead}}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "key without the scope",
+			key:   "vk_pos",
+			scope: models.ScopeBrandManager,
+			setupMock: func(m *MockDB) {
+				m.On("GetAPIKeyByHash", auth.HashKey("vk_pos")).
+					Return(&models.APIKey{ID: 3, Name: "pos", Scopes: []string{models.ScopeRedeem, models.ScopeRead}}, nil)
+			},
+			wantStatus: http.StatusForbidden,
+			wantCode:   CodeForbidden,
+		},
+		{
+			name:       "bootstrap key is admin",
+			key:        bootstrapKey,
+			scope:      models.ScopeBrandManager,
+			setupMock:  func(m *MockDB) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "database unavailable",
+			key:   "vk_pos",
+			scope: models.ScopeRead,
+			setupMock: func(m *MockDB) {
+				m.On("GetAPIKeyByHash", auth.HashKey("vk_pos")).
+					Return(nil, fmt.Errorf("%w: %w", database.ErrUnavailable, sql.ErrConnDone))
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   CodeUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+			h := NewHandler(mockDB)
+			h.SetBootstrapKey(bootstrapKey)
+
+			var principal *auth.Principal
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = auth.FromContext(r.Context())
+			})
+
+			req := httptest.NewRequest("GET", "/brands", nil)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			h.Authenticate(h.RequireScope(tt.scope)(next)).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantCode != "" {
+				var resp ErrorResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+				assert.Equal(t, tt.wantCode, resp.Error.Code)
+			}
+			if tt.wantStatus == http.StatusOK {
+				assert.NotNil(t, principal)
+			}
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthenticateBearerToken(t *testing.T) {
+	secret := []byte("test-secret")
+	sign := func(claims string) string {
+		signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte(claims))
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := sign(fmt.Sprintf(`{"sub":"7","exp":%d}`, exp))
+
+	tests := []struct {
+		name          string
+		authorization string
+		scopes        []string
+		noVerifier    bool
+		wantStatus    int
+	}{
+		{
+			name:          "customer may redeem",
+			authorization: "Bearer " + valid,
+			scopes:        []string{models.ScopeRedeem, models.ScopeCustomer},
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "customer cannot use operator routes",
+			authorization: "Bearer " + valid,
+			scopes:        []string{models.ScopeRead},
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "expired token",
+			authorization: "Bearer " + sign(fmt.Sprintf(`{"sub":"7","exp":%d}`, time.Now().Add(-time.Hour).Unix())),
+			scopes:        []string{models.ScopeCustomer},
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "tokens not configured",
+			authorization: "Bearer " + valid,
+			scopes:        []string{models.ScopeCustomer},
+			noVerifier:    true,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "other scheme",
+			authorization: "Basic " + valid,
+			scopes:        []string{models.ScopeCustomer},
+			wantStatus:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(new(MockDB))
+			if !tt.noVerifier {
+				verifier := auth.NewTokenVerifier("", "")
+				verifier.SetSecret(secret)
+				h.SetTokenVerifier(verifier)
+			}
+
+			var principal *auth.Principal
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = auth.FromContext(r.Context())
+			})
+
+			req := httptest.NewRequest("POST", "/redemptions", nil)
+			req.Header.Set("Authorization", tt.authorization)
+			rec := httptest.NewRecorder()
+			h.Authenticate(h.RequireScope(tt.scopes...)(next)).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK && assert.NotNil(t, principal) {
+				assert.Equal(t, 7, principal.CustomerID)
+				assert.Equal(t, "customer:7", principal.ID())
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// UpdateBrand handles changing a brand's name and description
+func (h *Handler) UpdateBrand(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid brand ID"))
+		return
+	}
+
+	var req models.UpdateBrandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+
+	brand, err := h.store(r).GetBrand(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	brand.Name = req.Name
+	brand.Description = req.Description
+	if err := brand.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.store(r).UpdateBrand(brand); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(brand)
+}
+
+// ArchiveBrand handles removing a brand from the program. All of its vouchers
+// are deactivated along with it.
+func (h *Handler) ArchiveBrand(w http.ResponseWriter, r *http.Request) {
+	h.changeBrandArchive(w, r, Database.ArchiveBrand)
+}
+
+// RestoreBrand handles bringing an archived brand back. Only the vouchers
+// that archiving deactivated are reactivated.
+func (h *Handler) RestoreBrand(w http.ResponseWriter, r *http.Request) {
+	h.changeBrandArchive(w, r, Database.RestoreBrand)
+}
+
+func (h *Handler) changeBrandArchive(w http.ResponseWriter, r *http.Request, change func(db Database, id int) (int, error)) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid brand ID"))
+		return
+	}
+
+	db := h.store(r)
+	changed, err := change(db, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	brand, err := db.GetBrand(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.BrandArchiveResult{Brand: brand, VouchersChanged: changed})
+}
+
+// brandFilter reads the brand list filters, sort and page from the query
+// string
+func brandFilter(r *http.Request) (models.BrandFilter, error) {
+	q := r.URL.Query()
+	var filter models.BrandFilter
+	var err error
+
+	if filter.Archived, err = queryBool(q, "archived"); err != nil {
+		return filter, err
+	}
+	filter.Search = q.Get("q")
+	if filter.PageRequest, err = pageRequest(q); err != nil {
+		return filter, err
+	}
+	return filter, filter.Validate()
+}
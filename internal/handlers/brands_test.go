@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveBrand(t *testing.T) {
+	archivedAt := time.Now()
+
+	tests := []struct {
+		name           string
+		path           string
+		brandID        string
+		expectedStatus int
+		wantChanged    int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "archive deactivates vouchers",
+			path:           "archive",
+			brandID:        "1",
+			expectedStatus: http.StatusOK,
+			wantChanged:    3,
+			setupMock: func(m *MockDB) {
+				m.On("ArchiveBrand", 1).Return(3, nil)
+				m.On("GetBrand", 1).Return(&models.Brand{ID: 1, Name: "Brand", ArchivedAt: &archivedAt}, nil)
+			},
+		},
+		{
+			name:           "restore reactivates vouchers",
+			path:           "restore",
+			brandID:        "1",
+			expectedStatus: http.StatusOK,
+			wantChanged:    2,
+			setupMock: func(m *MockDB) {
+				m.On("RestoreBrand", 1).Return(2, nil)
+				m.On("GetBrand", 1).Return(&models.Brand{ID: 1, Name: "Brand"}, nil)
+			},
+		},
+		{
+			name:           "unknown brand",
+			path:           "archive",
+			brandID:        "999",
+			expectedStatus: http.StatusNotFound,
+			setupMock: func(m *MockDB) {
+				m.On("ArchiveBrand", 999).Return(0, fmt.Errorf("brand 999: %w", database.ErrNotFound))
+			},
+		},
+		{
+			name:           "invalid ID",
+			path:           "restore",
+			brandID:        "abc",
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Post("/brands/{id}/archive", handler.ArchiveBrand)
+			router.Post("/brands/{id}/restore", handler.RestoreBrand)
+
+			req := httptest.NewRequest("POST", "/brands/"+tt.brandID+"/"+tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var result models.BrandArchiveResult
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+				assert.Equal(t, tt.wantChanged, result.VouchersChanged)
+			}
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListBrands(t *testing.T) {
+	archived := true
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "filters and page",
+			query:          "?archived=true&q=cafe&sort=name&limit=20",
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("ListBrands", models.BrandFilter{
+					Archived:    &archived,
+					Search:      "cafe",
+					PageRequest: models.PageRequest{Sort: "name", Limit: 20},
+				}).Return(&models.Page[models.Brand]{Data: []models.Brand{{ID: 1, Name: "Cafe"}}, NextCursor: "next"}, nil)
+			},
+		},
+		{
+			name:           "invalid archived flag",
+			query:          "?archived=sometimes",
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "invalid limit",
+			query:          "?limit=ten",
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			router := chi.NewRouter()
+			router.Get("/brands", NewHandler(mockDB).ListBrands)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/brands"+tt.query, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var page models.Page[models.Brand]
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+				assert.Len(t, page.Data, 1)
+				assert.Equal(t, "next", page.NextCursor)
+			}
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateCustomer handles customer creation
+func (h *Handler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateCustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+
+	customer := &models.Customer{
+		Name:     req.Name,
+		Email:    req.Email,
+		IsActive: true,
+	}
+
+	if err := customer.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	id, err := h.db.CreateCustomer(customer)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{"id": id})
+}
+
+// GetCustomer handles retrieving a customer by ID
+func (h *Handler) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid customer ID"))
+		return
+	}
+
+	customer, err := h.db.GetCustomer(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(customer)
+}
+
+// ListCustomers handles retrieving all customers
+func (h *Handler) ListCustomers(w http.ResponseWriter, r *http.Request) {
+	customers, err := h.db.ListCustomers()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(customers)
+}
+
+// UpdateCustomer handles changing a customer's name and email
+func (h *Handler) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid customer ID"))
+		return
+	}
+
+	var req models.UpdateCustomerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+
+	customer, err := h.db.GetCustomer(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	customer.Name = req.Name
+	customer.Email = req.Email
+	if err := customer.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.db.UpdateCustomer(customer); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(customer)
+}
+
+// DeactivateCustomer handles deactivating a customer. The record and its
+// history are kept; the customer just can no longer redeem.
+func (h *Handler) DeactivateCustomer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid customer ID"))
+		return
+	}
+
+	if _, err := h.db.GetCustomer(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.db.DeactivateCustomer(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
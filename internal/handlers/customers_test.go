@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateCustomer(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name: "valid customer creation",
+			requestBody: map[string]interface{}{
+				"name":  "Jane Doe",
+				"email": "jane@example.com",
+			},
+			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("CreateCustomer", mock.MatchedBy(func(c *models.Customer) bool {
+					return c.IsActive && c.PointsBalance == 0
+				})).Return(1, nil)
+			},
+		},
+		{
+			name: "invalid email",
+			requestBody: map[string]interface{}{
+				"name":  "Jane Doe",
+				"email": "not-an-email",
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name: "email already registered",
+			requestBody: map[string]interface{}{
+				"name":  "Jane Doe",
+				"email": "jane@example.com",
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("CreateCustomer", mock.Anything).Return(0, models.ErrEmailTaken)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Post("/customers", handler.CreateCustomer)
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/customers", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateCustomer(t *testing.T) {
+	existing := func() *models.Customer {
+		return &models.Customer{ID: 1, Name: "Jane Doe", Email: "jane@example.com", PointsBalance: 500, IsActive: true}
+	}
+
+	tests := []struct {
+		name           string
+		customerID     string
+		requestBody    map[string]interface{}
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:       "valid update keeps balance",
+			customerID: "1",
+			requestBody: map[string]interface{}{
+				"name":  "Jane Smith",
+				"email": "jane.smith@example.com",
+			},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(existing(), nil)
+				m.On("UpdateCustomer", mock.MatchedBy(func(c *models.Customer) bool {
+					return c.Name == "Jane Smith" && c.PointsBalance == 500
+				})).Return(nil)
+			},
+		},
+		{
+			name:       "email taken by another customer",
+			customerID: "1",
+			requestBody: map[string]interface{}{
+				"name":  "Jane Doe",
+				"email": "john@example.com",
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(existing(), nil)
+				m.On("UpdateCustomer", mock.Anything).Return(models.ErrEmailTaken)
+			},
+		},
+		{
+			name:       "unknown customer",
+			customerID: "999",
+			requestBody: map[string]interface{}{
+				"name":  "Jane Doe",
+				"email": "jane@example.com",
+			},
+			expectedStatus: http.StatusNotFound,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 999).Return(nil, fmt.Errorf("customer 999: %w", database.ErrNotFound))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Put("/customers/{id}", handler.UpdateCustomer)
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("PUT", "/customers/"+tt.customerID, bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeactivateCustomer(t *testing.T) {
+	mockDB := new(MockDB)
+	mockDB.On("GetCustomer", 1).Return(&models.Customer{ID: 1, IsActive: true}, nil)
+	mockDB.On("DeactivateCustomer", 1).Return(nil)
+
+	handler := NewHandler(mockDB)
+	router := chi.NewRouter()
+	router.Delete("/customers/{id}", handler.DeactivateCustomer)
+
+	req := httptest.NewRequest("DELETE", "/customers/1", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	mockDB.AssertExpectations(t)
+}
+
+func TestListCustomerRedemptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "status, date range and page",
+			query:          "?status=completed&from=2026-01-01T00:00:00Z&to=2026-02-01T00:00:00Z&limit=10",
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, IsActive: true}, nil)
+				m.On("ListCustomerRedemptions", 1, models.RedemptionFilter{
+					Status:      "completed",
+					From:        time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+					To:          time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+					PageRequest: models.PageRequest{Limit: 10},
+				}).Return(&models.Page[models.Redemption]{Data: []models.Redemption{{
+					ID:     7,
+					Status: "completed",
+					Items:  []models.RedemptionItem{{VoucherID: 2, VoucherName: "Coffee", Quantity: 1}},
+				}}}, nil)
+			},
+		},
+		{
+			name:           "unknown status and inverted range",
+			query:          "?status=lost&from=2026-02-01T00:00:00Z&to=2026-01-01T00:00:00Z",
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "unparsable date",
+			query:          "?from=yesterday",
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "unknown customer",
+			expectedStatus: http.StatusNotFound,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(nil, fmt.Errorf("customer 1: %w", database.ErrNotFound))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			router := chi.NewRouter()
+			router.Get("/customers/{id}/redemptions", NewHandler(mockDB).ListCustomerRedemptions)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("GET", "/customers/1/redemptions"+tt.query, nil))
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var page models.Page[models.Redemption]
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+				if assert.Len(t, page.Data, 1) {
+					assert.Equal(t, "Coffee", page.Data[0].Items[0].VoucherName)
+				}
+			}
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
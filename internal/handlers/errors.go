@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"voucher-api/internal/auth"
+	"voucher-api/internal/codegen"
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Error codes returned to clients. These are part of the API contract: add
+// new ones freely but never rename or reuse an existing code.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeInsufficientPoints  = "insufficient_points"
+	CodeVoucherExpired      = "voucher_expired"
+	CodeVoucherInactive     = "voucher_inactive"
+	CodeVoucherNotYetValid  = "voucher_not_yet_valid"
+	CodeCustomerInactive    = "customer_inactive"
+	CodeBrandArchived       = "brand_archived"
+	CodeOutOfStock          = "out_of_stock"
+	CodeStockNotLimited     = "stock_not_limited"
+	CodeLimitReached        = "redemption_limit_reached"
+	CodeEmailTaken          = "email_taken"
+	CodeIdempotencyConflict = "idempotency_conflict"
+	CodeIdempotencyPending  = "idempotency_in_progress"
+	CodeInvalidTransition   = "invalid_transition"
+	CodeConflict            = "conflict"
+	CodeInvalidReference    = "invalid_reference"
+	CodeUnavailable         = "unavailable"
+	CodeInternal            = "internal_error"
+)
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes what went wrong in a machine-readable way
+type ErrorBody struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// APIError is an error that already knows how it should be reported
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// errorMapping ties a sentinel error to the status and code it is reported
+// with. An empty message means the error's own text is shown; set one when
+// that text may carry details clients should not see.
+type errorMapping struct {
+	err     error
+	status  int
+	code    string
+	message string
+}
+
+// errorMappings is searched in order, so the specific model errors must come
+// before the general database errors that may wrap them
+var errorMappings = []errorMapping{
+	{auth.ErrMissingCredentials, http.StatusUnauthorized, CodeUnauthorized, ""},
+	{auth.ErrInvalidCredentials, http.StatusUnauthorized, CodeUnauthorized, ""},
+	{auth.ErrInvalidToken, http.StatusUnauthorized, CodeUnauthorized, ""},
+	{auth.ErrForbidden, http.StatusForbidden, CodeForbidden, ""},
+	{models.ErrInsufficientPoints, http.StatusBadRequest, CodeInsufficientPoints, ""},
+	{models.ErrExpiredVoucher, http.StatusBadRequest, CodeVoucherExpired, ""},
+	{models.ErrVoucherInactive, http.StatusBadRequest, CodeVoucherInactive, ""},
+	{models.ErrVoucherNotYetValid, http.StatusBadRequest, CodeVoucherNotYetValid, ""},
+	{models.ErrCustomerInactive, http.StatusBadRequest, CodeCustomerInactive, ""},
+	{models.ErrBrandArchived, http.StatusConflict, CodeBrandArchived, ""},
+	{models.ErrOutOfStock, http.StatusConflict, CodeOutOfStock, ""},
+	{models.ErrStockNotLimited, http.StatusConflict, CodeStockNotLimited, ""},
+	{models.ErrLimitReached, http.StatusConflict, CodeLimitReached, ""},
+	{models.ErrEmailTaken, http.StatusConflict, CodeEmailTaken, ""},
+	{models.ErrIdempotencyConflict, http.StatusConflict, CodeIdempotencyConflict, ""},
+	{models.ErrIdempotencyPending, http.StatusConflict, CodeIdempotencyPending, ""},
+	{models.ErrInvalidTransition, http.StatusConflict, CodeInvalidTransition, ""},
+	{models.ErrEmptyName, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrEmptyCode, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidPointsCost, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidEmail, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrNegativePoints, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrNoItems, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidStatus, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidEntryType, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrZeroAmount, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidPoints, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrEmptySource, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrEmptyIdempotencyKey, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidCustomerID, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidValidity, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidStock, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidQuantity, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrQuantityTooLarge, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrTooManyItems, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidVoucherID, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrMixedItems, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidCursor, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidSort, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidPageSize, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidPointsRange, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidDateRange, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrNoScopes, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidScope, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrTenantScope, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidLimit, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrInvalidLimitPeriod, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrDuplicateCode, http.StatusBadRequest, CodeValidationFailed, ""},
+	{models.ErrCodeTooLong, http.StatusBadRequest, CodeValidationFailed, ""},
+	{codegen.ErrInvalidLength, http.StatusBadRequest, CodeValidationFailed, ""},
+	{codegen.ErrInvalidAlphabet, http.StatusBadRequest, CodeValidationFailed, ""},
+	{codegen.ErrInvalidPrefix, http.StatusBadRequest, CodeValidationFailed, ""},
+	{codegen.ErrTooFewCodes, http.StatusBadRequest, CodeValidationFailed, ""},
+	{database.ErrNotFound, http.StatusNotFound, CodeNotFound, ""},
+	{database.ErrConflict, http.StatusConflict, CodeConflict, ""},
+	{database.ErrInvalidReference, http.StatusUnprocessableEntity, CodeInvalidReference, ""},
+	{database.ErrUnavailable, http.StatusServiceUnavailable, CodeUnavailable, "service temporarily unavailable"},
+}
+
+// NotFound reports a request for a route that does not exist
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: "route not found"})
+}
+
+// MethodNotAllowed reports a request whose route exists but not for its method
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, &APIError{Status: http.StatusMethodNotAllowed, Code: CodeMethodNotAllowed, Message: "method not allowed"})
+}
+
+// invalidRequest reports a request that could not be parsed
+func invalidRequest(message string) error {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: message}
+}
+
+// writeError reports err to the client as JSON. ValidationErrors are listed
+// field by field in the details. Errors that match neither an APIError,
+// ValidationErrors nor a known sentinel are logged and hidden behind a
+// generic 500 so driver messages never reach clients.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	requestID := middleware.GetReqID(r.Context())
+	body := ErrorBody{RequestID: requestID}
+	status := http.StatusInternalServerError
+
+	var apiErr *APIError
+	var validationErrs models.ValidationErrors
+	if errors.As(err, &apiErr) {
+		status = apiErr.Status
+		body.Code = apiErr.Code
+		body.Message = apiErr.Message
+		body.Details = apiErr.Details
+	} else if errors.As(err, &validationErrs) {
+		status = http.StatusBadRequest
+		body.Code = CodeValidationFailed
+		body.Message = err.Error()
+		body.Details = validationErrs
+	} else {
+		for _, m := range errorMappings {
+			if errors.Is(err, m.err) {
+				status = m.status
+				body.Code = m.code
+				body.Message = m.message
+				if body.Message == "" {
+					body.Message = err.Error()
+				}
+				break
+			}
+		}
+	}
+
+	if body.Code == "" {
+		log.Printf("request %s: %v", requestID, err)
+		body.Code = CodeInternal
+		body.Message = "internal server error"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: body})
+}
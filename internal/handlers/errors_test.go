@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{
+			name:        "api error",
+			err:         invalidRequest("invalid voucher ID"),
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeInvalidRequest,
+			wantMessage: "invalid voucher ID",
+		},
+		{
+			name:        "record not found",
+			err:         fmt.Errorf("voucher 7: %w", database.ErrNotFound),
+			wantStatus:  http.StatusNotFound,
+			wantCode:    CodeNotFound,
+			wantMessage: "voucher 7: not found",
+		},
+		{
+			name:        "conflict",
+			err:         fmt.Errorf("%w: voucher code %q already exists", database.ErrConflict, "SAVE10"),
+			wantStatus:  http.StatusConflict,
+			wantCode:    CodeConflict,
+			wantMessage: `conflict: voucher code "SAVE10" already exists`,
+		},
+		{
+			name:        "model error wrapped in conflict",
+			err:         fmt.Errorf("%w: %w", database.ErrConflict, models.ErrEmailTaken),
+			wantStatus:  http.StatusConflict,
+			wantCode:    CodeEmailTaken,
+			wantMessage: "conflict: " + models.ErrEmailTaken.Error(),
+		},
+		{
+			name:        "invalid reference",
+			err:         fmt.Errorf("%w: brand 9 does not exist", database.ErrInvalidReference),
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    CodeInvalidReference,
+			wantMessage: "invalid reference: brand 9 does not exist",
+		},
+		{
+			name:        "unavailable hides the cause",
+			err:         fmt.Errorf("%w: %w", database.ErrUnavailable, errors.New("dial tcp 10.0.0.5:3306: connection refused")),
+			wantStatus:  http.StatusServiceUnavailable,
+			wantCode:    CodeUnavailable,
+			wantMessage: "service temporarily unavailable",
+		},
+		{
+			name:        "wrapped sentinel",
+			err:         fmt.Errorf("credit 2: %w", models.ErrIdempotencyConflict),
+			wantStatus:  http.StatusConflict,
+			wantCode:    CodeIdempotencyConflict,
+			wantMessage: "credit 2: " + models.ErrIdempotencyConflict.Error(),
+		},
+		{
+			name:        "validation sentinel",
+			err:         models.ErrInvalidEmail,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    CodeValidationFailed,
+			wantMessage: models.ErrInvalidEmail.Error(),
+		},
+		{
+			name:        "driver error is hidden",
+			err:         errors.New("Error 1146: Table 'voucher_db.vouchers' doesn't exist"),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    CodeInternal,
+			wantMessage: "internal server error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			rec := httptest.NewRecorder()
+
+			middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, r, tt.err)
+			})).ServeHTTP(rec, req)
+
+			var resp ErrorResponse
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantCode, resp.Error.Code)
+			assert.Equal(t, tt.wantMessage, resp.Error.Message)
+			assert.NotEmpty(t, resp.Error.RequestID)
+		})
+	}
+}
+
+func TestWriteErrorValidationDetails(t *testing.T) {
+	var errs models.ValidationErrors
+	errs.Add("customer_id", models.ErrInvalidCustomerID)
+	errs.Add("items", models.ErrNoItems)
+
+	req := httptest.NewRequest("POST", "/redemptions", nil)
+	rec := httptest.NewRecorder()
+	writeError(rec, req, errs)
+
+	var resp struct {
+		Error struct {
+			Code    string              `json:"code"`
+			Details []models.FieldError `json:"details"`
+		} `json:"error"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, CodeValidationFailed, resp.Error.Code)
+	if assert.Len(t, resp.Error.Details, 2) {
+		assert.Equal(t, "customer_id", resp.Error.Details[0].Field)
+		assert.Equal(t, models.ErrInvalidCustomerID.Error(), resp.Error.Details[0].Message)
+		assert.Equal(t, "items", resp.Error.Details[1].Field)
+	}
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.NotFound(NotFound)
+	router.MethodNotAllowed(MethodNotAllowed)
+	router.Get("/vouchers", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"unknown route", "GET", "/nowhere", http.StatusNotFound, CodeNotFound},
+		{"wrong method", "DELETE", "/vouchers", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			var resp ErrorResponse
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantCode, resp.Error.Code)
+			assert.NotEmpty(t, resp.Error.RequestID)
+		})
+	}
+}
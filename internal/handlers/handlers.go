@@ -3,8 +3,11 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
+	"voucher-api/internal/auth"
 	"voucher-api/internal/models"
 
 	"github.com/go-chi/chi/v5"
@@ -14,49 +17,86 @@ import (
 type Database interface {
 	CreateBrand(brand *models.Brand) (int, error)
 	GetBrand(id int) (*models.Brand, error)
-	ListBrands() ([]models.Brand, error)
+	ListBrands(filter models.BrandFilter) (*models.Page[models.Brand], error)
+	UpdateBrand(brand *models.Brand) error
+	ArchiveBrand(id int) (int, error)
+	RestoreBrand(id int) (int, error)
 	CreateVoucher(voucher *models.Voucher) (int, error)
 	GetVoucher(id int) (*models.Voucher, error)
-	ListVouchers() ([]models.Voucher, error)
+	ListVouchers(filter models.VoucherFilter) (*models.Page[models.Voucher], error)
+	UpdateVoucher(voucher *models.Voucher, setActive, setStock bool) error
+	SetVoucherActive(id int, active bool) error
+	DeleteVoucher(id int) error
+	RestockVoucher(id int, quantity int) (*models.Voucher, error)
+	AddVoucherCodes(voucherID int, codes []string) (*models.VoucherCodePool, error)
+	CreateCustomer(customer *models.Customer) (int, error)
 	GetCustomer(id int) (*models.Customer, error)
+	ListCustomers() ([]models.Customer, error)
+	UpdateCustomer(customer *models.Customer) error
+	DeactivateCustomer(id int) error
 	CreateRedemption(redemption *models.Redemption) (int, error)
 	GetRedemption(id int) (*models.Redemption, error)
-	UpdateCustomerPoints(customerID int, points int) error
+	TransitionRedemption(id int, status string) (*models.Redemption, error)
+	ListCustomerRedemptions(customerID int, filter models.RedemptionFilter) (*models.Page[models.Redemption], error)
+	GetPointsLedger(customerID int) ([]models.PointsLedgerEntry, error)
+	CreditPoints(credits []models.PointsCredit) ([]models.PointsCreditResult, error)
+	ReconcileCustomerPoints(customerID int) (*models.PointsReconciliation, error)
+	ClaimIdempotencyKey(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	SaveIdempotentResponse(scope, key string, status int, body []byte) error
+	CreateAPIKey(key *models.APIKey, hash string) error
+	GetAPIKeyByHash(hash string) (*models.APIKey, error)
+	ListAPIKeys() ([]models.APIKey, error)
+	RevokeAPIKey(id int) error
+	CreateTenant(tenant *models.Tenant) error
+	ListTenants() ([]models.Tenant, error)
 	BeginTx() (*sql.Tx, error)
-	GetVouchersByBrand(brandID int) ([]models.Voucher, error)
+	GetVouchersByBrand(brandID int, filter models.VoucherFilter) (*models.Page[models.Voucher], error)
 }
 
 // Handler holds the HTTP handlers and db connection
 type Handler struct {
-	db Database
+	db               Database
+	idempotencyTTL   time.Duration
+	bootstrapKeyHash string
+	tokens           *auth.TokenVerifier
+	forTenant        func(tenantID int) Database
 }
 
 // NewHandler creates a new handler with the given database
 func NewHandler(db Database) *Handler {
-	return &Handler{db: db}
+	return &Handler{db: db, idempotencyTTL: DefaultIdempotencyTTL}
 }
 
-// CreateBrand handles brand creation
+// CreateBrand handles brand creation. Only admins may place the brand under
+// a tenant.
 func (h *Handler) CreateBrand(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateBrandRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, invalidRequest(err.Error()))
 		return
 	}
 
+	if req.TenantID != nil {
+		if principal, ok := auth.FromContext(r.Context()); !ok || !principal.HasScope(models.ScopeAdmin) {
+			writeError(w, r, fmt.Errorf("tenant_id: %w", auth.ErrForbidden))
+			return
+		}
+	}
+
 	brand := &models.Brand{
+		TenantID:    req.TenantID,
 		Name:        req.Name,
 		Description: req.Description,
 	}
 
 	if err := brand.Validate(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	id, err := h.db.CreateBrand(brand)
+	id, err := h.store(r).CreateBrand(brand)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -68,24 +108,30 @@ func (h *Handler) CreateBrand(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetBrand(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, "Invalid brand ID", http.StatusBadRequest)
+		writeError(w, r, invalidRequest("invalid brand ID"))
 		return
 	}
 
-	brand, err := h.db.GetBrand(id)
+	brand, err := h.store(r).GetBrand(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(brand)
 }
 
-// ListBrands handles retrieving all brands
+// ListBrands handles retrieving a page of brands
 func (h *Handler) ListBrands(w http.ResponseWriter, r *http.Request) {
-	brands, err := h.db.ListBrands()
+	filter, err := brandFilter(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	brands, err := h.store(r).ListBrands(filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -96,28 +142,35 @@ func (h *Handler) ListBrands(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) CreateVoucher(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateVoucherRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, invalidRequest(err.Error()))
 		return
 	}
 
 	voucher := &models.Voucher{
-		BrandID:     req.BrandID,
-		Code:        req.Code,
-		Name:        req.Name,
-		Description: req.Description,
-		PointsCost:  req.PointsCost,
-		ValidUntil:  req.ValidUntil,
-		IsActive:    true,
+		BrandID:          req.BrandID,
+		Code:             req.Code,
+		Name:             req.Name,
+		Description:      req.Description,
+		PointsCost:       req.PointsCost,
+		TotalStock:       req.TotalStock,
+		RemainingStock:   req.TotalStock,
+		PerCustomerLimit: req.PerCustomerLimit,
+		LimitPeriod:      req.LimitPeriod,
+		ValidFrom:        req.ValidFrom,
+		ValidUntil:       req.ValidUntil,
+		IsActive:         true,
 	}
 
 	if err := voucher.Validate(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	id, err := h.db.CreateVoucher(voucher)
+	// The store checks, under the brand's lock, that the brand exists and is
+	// not archived
+	id, err := h.store(r).CreateVoucher(voucher)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -129,24 +182,30 @@ func (h *Handler) CreateVoucher(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetVoucher(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, "Invalid voucher ID", http.StatusBadRequest)
+		writeError(w, r, invalidRequest("invalid voucher ID"))
 		return
 	}
 
-	voucher, err := h.db.GetVoucher(id)
+	voucher, err := h.store(r).GetVoucher(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(voucher)
 }
 
-// ListVouchers handles retrieving all vouchers
+// ListVouchers handles retrieving a page of vouchers
 func (h *Handler) ListVouchers(w http.ResponseWriter, r *http.Request) {
-	vouchers, err := h.db.ListVouchers()
+	filter, err := voucherFilter(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+
+	vouchers, err := h.store(r).ListVouchers(filter)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -157,93 +216,216 @@ func (h *Handler) ListVouchers(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) CreateRedemption(w http.ResponseWriter, r *http.Request) {
 	var req models.RedemptionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, invalidRequest(err.Error()))
 		return
 	}
 
+	// Customers signed in with a token can only redeem for themselves
+	if principal, ok := auth.FromContext(r.Context()); ok && principal.CustomerID != 0 {
+		if req.CustomerID != 0 && req.CustomerID != principal.CustomerID {
+			writeError(w, r, fmt.Errorf("customer %d: %w", req.CustomerID, auth.ErrForbidden))
+			return
+		}
+		req.CustomerID = principal.CustomerID
+	}
+
+	if err := req.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	lines := req.Lines()
+
 	// Get customer
 	customer, err := h.db.GetCustomer(req.CustomerID)
 	if err != nil {
-		http.Error(w, "Customer not found", http.StatusNotFound)
+		writeError(w, r, err)
+		return
+	}
+	if !customer.IsActive {
+		writeError(w, r, models.ErrCustomerInactive)
 		return
 	}
 
 	// Calculate total points cost and validate vouchers
+	now := time.Now()
 	var totalPoints int
 	var items []models.RedemptionItem
-	for _, vID := range req.VoucherIDs {
+	quantities := map[int]int{}
+	for _, line := range lines {
+		vID := line.VoucherID
 		voucher, err := h.db.GetVoucher(vID)
 		if err != nil {
-			http.Error(w, "Voucher not found", http.StatusNotFound)
+			writeError(w, r, err)
+			return
+		}
+		if err := voucher.CheckRedeemable(now); err != nil {
+			writeError(w, r, fmt.Errorf("voucher %d: %w", vID, err))
 			return
 		}
-		if !voucher.IsActive {
-			http.Error(w, "Voucher is not active", http.StatusBadRequest)
+		// Whether the voucher is redeemable, its price, its stock and the
+		// customer's earlier redemptions are read again under lock when the
+		// redemption is stored; this only rejects baskets early
+		quantities[vID] += line.Quantity
+		if !voucher.InStock(quantities[vID]) {
+			writeError(w, r, fmt.Errorf("voucher %d: %w", vID, models.ErrOutOfStock))
 			return
 		}
-		totalPoints += voucher.PointsCost
+		if !voucher.AllowsQuantity(0, quantities[vID]) {
+			writeError(w, r, fmt.Errorf("voucher %d: %w", vID, models.ErrLimitReached))
+			return
+		}
+		totalPoints += voucher.PointsCost * line.Quantity
 		items = append(items, models.RedemptionItem{
-			VoucherID:  vID,
-			PointsCost: voucher.PointsCost,
+			VoucherID:   vID,
+			VoucherName: voucher.Name,
+			Quantity:    line.Quantity,
+			PointsCost:  voucher.PointsCost,
 		})
 	}
 
 	if customer.PointsBalance < totalPoints {
-		http.Error(w, "Insufficient points", http.StatusBadRequest)
+		writeError(w, r, models.ErrInsufficientPoints)
 		return
 	}
 
 	redemption := &models.Redemption{
 		CustomerID:      req.CustomerID,
 		TotalPointsCost: totalPoints,
-		Status:          "pending",
+		Status:          models.StatusPending,
 		Items:           items,
 	}
-
-	id, err := h.db.CreateRedemption(redemption)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := redemption.Validate(); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	// Update customer points
-	err = h.db.UpdateCustomerPoints(customer.ID, customer.PointsBalance-totalPoints)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Persist the redemption and deduct points atomically; the total is
+	// recomputed from the locked prices and the balance re-checked under a
+	// row lock in case either changed since the reads above
+	if _, err := h.db.CreateRedemption(redemption); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
+	// The stored redemption, with its IDs and pool codes, is answered as is:
+	// once points are deducted the response must not hinge on another read
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]int{"id": id})
+	json.NewEncoder(w).Encode(redemption)
 }
 
 // GetRedemption handles retrieving a redemption by ID
 func (h *Handler) GetRedemption(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, "Invalid redemption ID", http.StatusBadRequest)
+		writeError(w, r, invalidRequest("invalid redemption ID"))
 		return
 	}
 
 	redemption, err := h.db.GetRedemption(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(redemption)
+}
+
+// ListCustomerRedemptions handles retrieving a page of a customer's
+// redemption history
+func (h *Handler) ListCustomerRedemptions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid customer ID"))
+		return
+	}
+
+	filter, err := redemptionFilter(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if _, err := h.db.GetCustomer(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	redemptions, err := h.db.ListCustomerRedemptions(id, filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(redemptions)
+}
+
+// redemptionFilter reads the redemption history filters, sort and page from
+// the query string
+func redemptionFilter(r *http.Request) (models.RedemptionFilter, error) {
+	q := r.URL.Query()
+	filter := models.RedemptionFilter{Status: q.Get("status")}
+	var err error
+
+	if filter.From, err = queryTime(q, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = queryTime(q, "to"); err != nil {
+		return filter, err
+	}
+	if filter.PageRequest, err = pageRequest(q); err != nil {
+		return filter, err
+	}
+	return filter, filter.Validate()
+}
+
+// CompleteRedemption handles marking a redemption as fulfilled
+func (h *Handler) CompleteRedemption(w http.ResponseWriter, r *http.Request) {
+	h.transitionRedemption(w, r, models.StatusCompleted)
+}
+
+// CancelRedemption handles cancelling a redemption and refunding its points
+func (h *Handler) CancelRedemption(w http.ResponseWriter, r *http.Request) {
+	h.transitionRedemption(w, r, models.StatusCancelled)
+}
+
+// FailRedemption handles marking a redemption as failed and refunding its points
+func (h *Handler) FailRedemption(w http.ResponseWriter, r *http.Request) {
+	h.transitionRedemption(w, r, models.StatusFailed)
+}
+
+func (h *Handler) transitionRedemption(w http.ResponseWriter, r *http.Request, status string) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid redemption ID"))
+		return
+	}
+
+	redemption, err := h.db.TransitionRedemption(id, status)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(redemption)
 }
 
+// GetVouchersByBrand handles retrieving a page of the vouchers of a brand
 func (h *Handler) GetVouchersByBrand(w http.ResponseWriter, r *http.Request) {
-	brandID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	brandID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid brand ID"))
+		return
+	}
+
+	filter, err := voucherFilter(r)
 	if err != nil {
-		http.Error(w, "invalid brand ID", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	vouchers, err := h.db.GetVouchersByBrand(brandID)
+	vouchers, err := h.store(r).GetVouchersByBrand(brandID, filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
+	"voucher-api/internal/auth"
+	"voucher-api/internal/database"
 	"voucher-api/internal/models"
 
 	"github.com/go-chi/chi/v5"
@@ -20,6 +25,7 @@ func TestCreateBrand(t *testing.T) {
 	tests := []struct {
 		name           string
 		requestBody    map[string]interface{}
+		principal      *auth.Principal
 		expectedStatus int
 		setupMock      func(*MockDB)
 	}{
@@ -43,6 +49,24 @@ func TestCreateBrand(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			setupMock:      func(m *MockDB) {},
 		},
+		{
+			name:           "admin assigns the brand to a tenant",
+			requestBody:    map[string]interface{}{"name": "Acme", "tenant_id": 3},
+			principal:      &auth.Principal{Scopes: []string{models.ScopeAdmin}},
+			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("CreateBrand", mock.MatchedBy(func(b *models.Brand) bool {
+					return b.TenantID != nil && *b.TenantID == 3
+				})).Return(1, nil)
+			},
+		},
+		{
+			name:           "brand manager cannot assign a tenant",
+			requestBody:    map[string]interface{}{"name": "Acme", "tenant_id": 3},
+			principal:      &auth.Principal{Scopes: []string{models.ScopeBrandManager}},
+			expectedStatus: http.StatusForbidden,
+			setupMock:      func(m *MockDB) {},
+		},
 	}
 
 	for _, tt := range tests {
@@ -57,6 +81,9 @@ func TestCreateBrand(t *testing.T) {
 			body, _ := json.Marshal(tt.requestBody)
 			req := httptest.NewRequest("POST", "/brands", bytes.NewBuffer(body))
 			req.Header.Set("Content-Type", "application/json")
+			if tt.principal != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), tt.principal))
+			}
 			rec := httptest.NewRecorder()
 
 			router.ServeHTTP(rec, req)
@@ -91,7 +118,7 @@ func TestGetBrand(t *testing.T) {
 			brandID:        "999",
 			expectedStatus: http.StatusNotFound,
 			setupMock: func(m *MockDB) {
-				m.On("GetBrand", 999).Return(nil, sql.ErrNoRows)
+				m.On("GetBrand", 999).Return(nil, fmt.Errorf("brand 999: %w", database.ErrNotFound))
 			},
 		},
 	}
@@ -149,6 +176,47 @@ func TestCreateVoucher(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			setupMock:      func(m *MockDB) {},
 		},
+		{
+			name: "duplicate code",
+			requestBody: map[string]interface{}{
+				"brand_id":    1,
+				"code":        "TEST123",
+				"name":        "Test Voucher",
+				"points_cost": 100,
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("CreateVoucher", mock.Anything).
+					Return(0, fmt.Errorf("%w: voucher code %q already exists", database.ErrConflict, "TEST123"))
+			},
+		},
+		{
+			name: "unknown brand",
+			requestBody: map[string]interface{}{
+				"brand_id":    999,
+				"code":        "TEST123",
+				"name":        "Test Voucher",
+				"points_cost": 100,
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+			setupMock: func(m *MockDB) {
+				m.On("CreateVoucher", mock.Anything).
+					Return(0, fmt.Errorf("%w: brand 999 does not exist", database.ErrInvalidReference))
+			},
+		},
+		{
+			name: "archived brand",
+			requestBody: map[string]interface{}{
+				"brand_id":    2,
+				"code":        "TEST123",
+				"name":        "Test Voucher",
+				"points_cost": 100,
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("CreateVoucher", mock.Anything).Return(0, models.ErrBrandArchived)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -177,6 +245,7 @@ func TestCreateRedemption(t *testing.T) {
 	tests := []struct {
 		name           string
 		requestBody    map[string]interface{}
+		principal      *auth.Principal
 		expectedStatus int
 		setupMock      func(*MockDB)
 	}{
@@ -187,14 +256,205 @@ func TestCreateRedemption(t *testing.T) {
 				"voucher_ids": []int{1, 2},
 			},
 			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true}, nil)
+				m.On("GetVoucher", 2).Return(&models.Voucher{ID: 2, PointsCost: 200, IsActive: true}, nil)
+				m.On("CreateRedemption", mock.MatchedBy(func(r *models.Redemption) bool {
+					return r.CustomerID == 1 && r.TotalPointsCost == 300 && len(r.Items) == 2
+				})).Return(1, nil)
+			},
+		},
+		{
+			name: "items priced by quantity",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"items":       []map[string]int{{"voucher_id": 1, "quantity": 3}},
+			},
+			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true}, nil)
+				m.On("CreateRedemption", mock.MatchedBy(func(r *models.Redemption) bool {
+					return r.TotalPointsCost == 300 && len(r.Items) == 1 && r.Items[0].Quantity == 3 &&
+						r.Items[0].PointsCost == 100
+				})).Return(1, nil)
+			},
+		},
+		{
+			name: "repeated voucher ids become one line",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"voucher_ids": []int{1, 1},
+			},
+			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true}, nil).Once()
+				m.On("CreateRedemption", mock.MatchedBy(func(r *models.Redemption) bool {
+					return r.TotalPointsCost == 200 && len(r.Items) == 1 && r.Items[0].Quantity == 2
+				})).Return(1, nil)
+			},
+		},
+		{
+			name: "quantity above the bound",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"items":       []map[string]int{{"voucher_id": 1, "quantity": models.MaxItemQuantity + 1}},
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name: "zero quantity",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"items":       []map[string]int{{"voucher_id": 1, "quantity": 0}},
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "empty basket is rejected before any lookup",
+			requestBody:    map[string]interface{}{"customer_id": 1, "voucher_ids": []int{}},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name: "items and voucher ids together",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"items":       []map[string]int{{"voucher_id": 1, "quantity": 1}},
+				"voucher_ids": []int{2},
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name: "balance spent before commit",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"voucher_ids": []int{1},
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true}, nil)
+				m.On("CreateRedemption", mock.Anything).Return(0, models.ErrInsufficientPoints)
+			},
+		},
+		{
+			name: "inactive customer",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"voucher_ids": []int{1},
+			},
+			expectedStatus: http.StatusBadRequest,
 			setupMock: func(m *MockDB) {
 				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000}, nil)
-				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100}, nil)
-				m.On("GetVoucher", 2).Return(&models.Voucher{ID: 2, PointsCost: 200}, nil)
-				m.On("CreateRedemption", mock.Anything).Return(1, nil)
-				m.On("UpdateCustomerPoints", 1, 700).Return(nil)
 			},
 		},
+		{
+			name: "expired voucher",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"voucher_ids": []int{1},
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{
+					ID: 1, PointsCost: 100, IsActive: true, ValidUntil: time.Now().Add(-time.Hour),
+				}, nil)
+			},
+		},
+		{
+			name: "voucher not valid yet",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"voucher_ids": []int{1},
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{
+					ID: 1, PointsCost: 100, IsActive: true, ValidFrom: time.Now().Add(time.Hour),
+				}, nil)
+			},
+		},
+		{
+			name: "not enough stock for repeated voucher",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"voucher_ids": []int{1, 1},
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				remaining := 1
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true, RemainingStock: &remaining}, nil)
+			},
+		},
+		{
+			name: "basket exceeds per customer limit",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"voucher_ids": []int{1, 1},
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				limit := 1
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true, PerCustomerLimit: &limit}, nil)
+			},
+		},
+		{
+			name: "limit reached by earlier redemptions",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"voucher_ids": []int{1},
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				limit := 1
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true, PerCustomerLimit: &limit}, nil)
+				m.On("CreateRedemption", mock.Anything).Return(0, fmt.Errorf("voucher 1: %w", models.ErrLimitReached))
+			},
+		},
+		{
+			name: "sold out before commit",
+			requestBody: map[string]interface{}{
+				"customer_id": 1,
+				"voucher_ids": []int{1},
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true}, nil)
+				m.On("CreateRedemption", mock.Anything).Return(0, fmt.Errorf("voucher 1: %w", models.ErrOutOfStock))
+			},
+		},
+		{
+			name:           "customer token redeems for its own customer",
+			requestBody:    map[string]interface{}{"voucher_ids": []int{1}},
+			principal:      &auth.Principal{CustomerID: 7, Scopes: []string{models.ScopeCustomer}},
+			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 7).Return(&models.Customer{ID: 7, PointsBalance: 1000, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true}, nil)
+				m.On("CreateRedemption", mock.MatchedBy(func(r *models.Redemption) bool {
+					return r.CustomerID == 7
+				})).Return(1, nil)
+			},
+		},
+		{
+			name:           "customer token cannot redeem for another customer",
+			requestBody:    map[string]interface{}{"customer_id": 1, "voucher_ids": []int{1}},
+			principal:      &auth.Principal{CustomerID: 7, Scopes: []string{models.ScopeCustomer}},
+			expectedStatus: http.StatusForbidden,
+			setupMock:      func(m *MockDB) {},
+		},
 		{
 			name: "insufficient points",
 			requestBody: map[string]interface{}{
@@ -203,8 +463,8 @@ func TestCreateRedemption(t *testing.T) {
 			},
 			expectedStatus: http.StatusBadRequest,
 			setupMock: func(m *MockDB) {
-				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 50}, nil)
-				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100}, nil)
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 50, IsActive: true}, nil)
+				m.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true}, nil)
 			},
 		},
 	}
@@ -221,6 +481,9 @@ func TestCreateRedemption(t *testing.T) {
 			body, _ := json.Marshal(tt.requestBody)
 			req := httptest.NewRequest("POST", "/redemptions", bytes.NewBuffer(body))
 			req.Header.Set("Content-Type", "application/json")
+			if tt.principal != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), tt.principal))
+			}
 			rec := httptest.NewRecorder()
 
 			router.ServeHTTP(rec, req)
@@ -231,21 +494,190 @@ func TestCreateRedemption(t *testing.T) {
 	}
 }
 
-func TestGetVouchersByBrand(t *testing.T) {
+func TestTransitionRedemption(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "complete pending redemption",
+			path:           "/redemptions/1/complete",
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("TransitionRedemption", 1, models.StatusCompleted).
+					Return(&models.Redemption{ID: 1, Status: models.StatusCompleted}, nil)
+			},
+		},
+		{
+			name:           "cancel redemption",
+			path:           "/redemptions/1/cancel",
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("TransitionRedemption", 1, models.StatusCancelled).
+					Return(&models.Redemption{ID: 1, Status: models.StatusCancelled}, nil)
+			},
+		},
+		{
+			name:           "fail cancelled redemption",
+			path:           "/redemptions/1/fail",
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("TransitionRedemption", 1, models.StatusFailed).Return(nil, models.ErrInvalidTransition)
+			},
+		},
+		{
+			name:           "unknown redemption",
+			path:           "/redemptions/999/complete",
+			expectedStatus: http.StatusNotFound,
+			setupMock: func(m *MockDB) {
+				m.On("TransitionRedemption", 999, models.StatusCompleted).Return(nil, fmt.Errorf("redemption 999: %w", database.ErrNotFound))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Post("/redemptions/{id}/complete", handler.CompleteRedemption)
+			router.Post("/redemptions/{id}/cancel", handler.CancelRedemption)
+			router.Post("/redemptions/{id}/fail", handler.FailRedemption)
+
+			req := httptest.NewRequest("POST", tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+// TestCreateRedemptionResponse checks that the 201 is built from the
+// redemption as CreateRedemption stored it, without reading it back
+func TestCreateRedemptionResponse(t *testing.T) {
+	mockDB := new(MockDB)
+	mockDB.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 1000, IsActive: true}, nil)
+	mockDB.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, Name: "Gift card", PointsCost: 100, IsActive: true}, nil)
+	mockDB.On("CreateRedemption", mock.Anything).Return(7, nil).Run(func(args mock.Arguments) {
+		r := args.Get(0).(*models.Redemption)
+		r.ID = 7
+		r.Items[0].ID = 3
+		r.Items[0].RedemptionID = 7
+		r.Items[0].Codes = []string{"GIFT-0031"}
+	})
+
+	router := chi.NewRouter()
+	router.Post("/redemptions", NewHandler(mockDB).CreateRedemption)
+
+	body, _ := json.Marshal(map[string]interface{}{"customer_id": 1, "voucher_ids": []int{1}})
+	req := httptest.NewRequest("POST", "/redemptions", bytes.NewBuffer(body))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var got models.Redemption
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, 7, got.ID)
+	if assert.Len(t, got.Items, 1) {
+		assert.Equal(t, 3, got.Items[0].ID)
+		assert.Equal(t, "Gift card", got.Items[0].VoucherName)
+		assert.Equal(t, []string{"GIFT-0031"}, got.Items[0].Codes)
+	}
+	mockDB.AssertNotCalled(t, "GetRedemption", mock.Anything)
+	mockDB.AssertExpectations(t)
+}
+
+// balanceDB is a fake store that turns redemptions away with
+// ErrInsufficientPoints once its balance runs out. It does not stand in for
+// the database's guarded decrement, which TestDeductPoints and
+// TestCreateRedemption in the database package cover.
+type balanceDB struct {
+	*MockDB
+	mu      sync.Mutex
+	balance int
+}
+
+func (b *balanceDB) GetCustomer(id int) (*models.Customer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &models.Customer{ID: id, PointsBalance: b.balance, IsActive: true}, nil
+}
+
+func (b *balanceDB) CreateRedemption(redemption *models.Redemption) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.balance < redemption.TotalPointsCost {
+		return 0, models.ErrInsufficientPoints
+	}
+	b.balance -= redemption.TotalPointsCost
+	return 1, nil
+}
+
+// TestCreateRedemptionPassesStoreRejectionThrough checks only that, when the
+// store refuses a redemption with ErrInsufficientPoints after the handler's
+// own balance check passed, parallel requests get insufficient_points rather
+// than an internal error
+func TestCreateRedemptionPassesStoreRejectionThrough(t *testing.T) {
 	mockDB := new(MockDB)
-	handler := NewHandler(mockDB)
+	mockDB.On("GetVoucher", 1).Return(&models.Voucher{ID: 1, PointsCost: 100, IsActive: true}, nil)
+	db := &balanceDB{MockDB: mockDB, balance: 500}
+
+	router := chi.NewRouter()
+	router.Post("/redemptions", NewHandler(db).CreateRedemption)
+
+	// Every request may pass the handler's own balance check before any of
+	// them is charged, so most of them are refused by the store
+	const requests = 20
+	codes := make(chan string, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, _ := json.Marshal(map[string]interface{}{"customer_id": 1, "voucher_ids": []int{1}})
+			req := httptest.NewRequest("POST", "/redemptions", bytes.NewBuffer(body))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code == http.StatusCreated {
+				codes <- "created"
+				return
+			}
+			var resp ErrorResponse
+			json.NewDecoder(rec.Body).Decode(&resp)
+			codes <- resp.Error.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[string]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, 5, counts["created"])
+	assert.Equal(t, requests-5, counts[CodeInsufficientPoints])
+}
 
+func TestGetVouchersByBrand(t *testing.T) {
 	tests := []struct {
 		name       string
 		brandID    string
-		setupMock  func()
+		query      string
+		setupMock  func(*MockDB)
 		wantStatus int
 		wantBody   string
 	}{
 		{
 			name:    "success",
 			brandID: "1",
-			setupMock: func() {
+			setupMock: func(m *MockDB) {
 				vouchers := []models.Voucher{
 					{
 						ID:          1,
@@ -266,45 +698,125 @@ func TestGetVouchersByBrand(t *testing.T) {
 						IsActive:    true,
 					},
 				}
-				mockDB.On("GetVouchersByBrand", 1).Return(vouchers, nil)
+				m.On("GetVouchersByBrand", 1, models.VoucherFilter{}).Return(&models.Page[models.Voucher]{Data: vouchers, NextCursor: "next"}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody: `{"data":[{"id":1,"brand_id":1,"code":"CODE1","name":"Test Voucher 1","description":"Test Description 1","points_cost":100,"total_stock":null,"remaining_stock":null,"per_customer_limit":null,"code_pool":false,"is_active":true,"valid_from":"0001-01-01T00:00:00Z","valid_until":"0001-01-01T00:00:00Z","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"},` +
+				`{"id":2,"brand_id":1,"code":"CODE2","name":"Test Voucher 2","description":"Test Description 2","points_cost":200,"total_stock":null,"remaining_stock":null,"per_customer_limit":null,"code_pool":false,"is_active":true,"valid_from":"0001-01-01T00:00:00Z","valid_until":"0001-01-01T00:00:00Z","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}],"next_cursor":"next"}`,
+		},
+		{
+			name:    "exclude expired",
+			brandID: "1",
+			query:   "?exclude_expired=true",
+			setupMock: func(m *MockDB) {
+				m.On("GetVouchersByBrand", 1, models.VoucherFilter{ExcludeExpired: true}).
+					Return(&models.Page[models.Voucher]{Data: []models.Voucher{}}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":[]}`,
+		},
+		{
+			name:    "filters, sort and page",
+			brandID: "1",
+			query:   "?active=true&expires_before=2026-01-01T00:00:00Z&min_points=100&max_points=500&q=coffee&sort=-points_cost&cursor=abc&limit=10",
+			setupMock: func(m *MockDB) {
+				active, minPoints, maxPoints := true, 100, 500
+				m.On("GetVouchersByBrand", 1, models.VoucherFilter{
+					Active:        &active,
+					ExpiresBefore: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+					MinPoints:     &minPoints,
+					MaxPoints:     &maxPoints,
+					Search:        "coffee",
+					PageRequest:   models.PageRequest{Sort: "-points_cost", Cursor: "abc", Limit: 10},
+				}).Return(&models.Page[models.Voucher]{Data: []models.Voucher{}}, nil)
 			},
 			wantStatus: http.StatusOK,
-			wantBody:   `[{"id":1,"brand_id":1,"code":"CODE1","name":"Test Voucher 1","description":"Test Description 1","points_cost":100,"is_active":true},{"id":2,"brand_id":1,"code":"CODE2","name":"Test Voucher 2","description":"Test Description 2","points_cost":200,"is_active":true}]`,
+			wantBody:   `{"data":[]}`,
+		},
+		{
+			name:       "page size too large",
+			brandID:    "1",
+			query:      "?limit=500",
+			setupMock:  func(m *MockDB) {},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":{"code":"validation_failed","message":"limit must be between 1 and 200"}}`,
+		},
+		{
+			name:       "inverted points range",
+			brandID:    "1",
+			query:      "?min_points=500&max_points=100",
+			setupMock:  func(m *MockDB) {},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":{"code":"validation_failed","message":"min_points cannot be more than max_points"}}`,
+		},
+		{
+			name:    "invalid sort",
+			brandID: "1",
+			query:   "?sort=color",
+			setupMock: func(m *MockDB) {
+				m.On("GetVouchersByBrand", 1, models.VoucherFilter{PageRequest: models.PageRequest{Sort: "color"}}).
+					Return(nil, fmt.Errorf("sort %q: %w", "color", models.ErrInvalidSort))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":{"code":"validation_failed","message":"sort \"color\": list cannot be sorted by that field"}}`,
+		},
+		{
+			name:       "invalid filter",
+			brandID:    "1",
+			query:      "?exclude_expired=maybe",
+			setupMock:  func(m *MockDB) {},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":{"code":"invalid_request","message":"exclude_expired must be true or false"}}`,
 		},
 		{
 			name:    "invalid brand ID",
 			brandID: "invalid",
-			setupMock: func() {
+			setupMock: func(m *MockDB) {
 				// No mock setup needed for invalid ID
 			},
 			wantStatus: http.StatusBadRequest,
-			wantBody:   "invalid brand ID\n",
+			wantBody:   `{"error":{"code":"invalid_request","message":"invalid brand ID"}}`,
 		},
 		{
 			name:    "database error",
 			brandID: "1",
-			setupMock: func() {
-				mockDB.On("GetVouchersByBrand", 1).Return(nil, sql.ErrNoRows)
+			setupMock: func(m *MockDB) {
+				m.On("GetVouchersByBrand", 1, models.VoucherFilter{}).Return(nil, sql.ErrConnDone)
 			},
 			wantStatus: http.StatusInternalServerError,
-			wantBody:   "sql: no rows in result set\n",
+			wantBody:   `{"error":{"code":"internal_error","message":"internal server error"}}`,
+		},
+		{
+			name:    "database unavailable",
+			brandID: "1",
+			setupMock: func(m *MockDB) {
+				m.On("GetVouchersByBrand", 1, models.VoucherFilter{}).Return(nil, fmt.Errorf("%w: %w", database.ErrUnavailable, sql.ErrConnDone))
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"error":{"code":"unavailable","message":"service temporarily unavailable"}}`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.setupMock()
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
 
-			req := httptest.NewRequest("GET", "/vouchers/brand?id="+tt.brandID, nil)
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Get("/brands/{id}/vouchers", handler.GetVouchersByBrand)
+
+			req := httptest.NewRequest("GET", "/brands/"+tt.brandID+"/vouchers"+tt.query, nil)
 			w := httptest.NewRecorder()
 
-			handler.GetVouchersByBrand(w, req)
+			router.ServeHTTP(w, req)
 
 			resp := w.Result()
 			body, _ := io.ReadAll(resp.Body)
 
 			assert.Equal(t, tt.wantStatus, resp.StatusCode)
 			assert.JSONEq(t, tt.wantBody, string(body))
+			mockDB.AssertExpectations(t)
 		})
 	}
 }
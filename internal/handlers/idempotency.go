@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+	"voucher-api/internal/auth"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// IdempotencyKeyHeader is the request header clients set to make a POST safe
+// to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyTTL is how long a response is kept for replay unless
+// SetIdempotencyTTL says otherwise
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKeyLength matches the width of the idempotency_keys.idem_key
+// column
+const maxIdempotencyKeyLength = 255
+
+// SetIdempotencyTTL changes how long responses are kept for replay
+func (h *Handler) SetIdempotencyTTL(ttl time.Duration) {
+	h.idempotencyTTL = ttl
+}
+
+// Idempotent makes a POST endpoint safe to retry. When a request carries an
+// Idempotency-Key header, the first response to that key is stored and
+// replayed for any retry within the retention window, without running the
+// handler again. Reusing a key with a different body is rejected, as is a
+// retry that arrives while the first request is still being handled. Server
+// errors are stored too: once the handler has run it may have committed its
+// work, so running it again for the same key could, say, deduct points twice.
+// Requests without the header are handled as usual.
+func (h *Handler) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, r, invalidRequest("Idempotency-Key cannot be longer than 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, invalidRequest(err.Error()))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		// Keys are chosen by clients, so keep each client's keys apart
+		scope := r.Method + " " + r.URL.Path
+		if principal, ok := auth.FromContext(r.Context()); ok {
+			scope += " " + principal.ID()
+		}
+		existing, err := h.db.ClaimIdempotencyKey(&models.IdempotencyRecord{
+			Scope:       scope,
+			Key:         key,
+			RequestHash: hex.EncodeToString(sum[:]),
+			ExpiresAt:   time.Now().Add(h.idempotencyTTL),
+		})
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if existing != nil {
+			replay(w, r, existing, hex.EncodeToString(sum[:]))
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		var response bytes.Buffer
+		ww.Tee(&response)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// If the response cannot be stored the claim is kept without one, so
+		// retries are told the request is in progress until the key expires
+		// rather than running it again
+		if err := h.db.SaveIdempotentResponse(scope, key, status, response.Bytes()); err != nil {
+			log.Printf("request %s: storing idempotent response: %v", middleware.GetReqID(r.Context()), err)
+		}
+	})
+}
+
+// replay answers a retried request from the stored record of the first one
+func replay(w http.ResponseWriter, r *http.Request, record *models.IdempotencyRecord, requestHash string) {
+	if record.RequestHash != requestHash {
+		writeError(w, r, models.ErrIdempotencyConflict)
+		return
+	}
+	if record.StatusCode == 0 {
+		writeError(w, r, models.ErrIdempotencyPending)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
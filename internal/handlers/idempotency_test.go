@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIdempotent(t *testing.T) {
+	const body = `{"name":"Brand"}`
+	const otherBody = `{"name":"Other"}`
+
+	tests := []struct {
+		name        string
+		key         string
+		body        string
+		handlerCode int
+		setupMock   func(*MockDB)
+		wantStatus  int
+		wantCalls   int
+		wantBody    string
+		wantReplay  bool
+	}{
+		{
+			name:        "no key",
+			body:        body,
+			handlerCode: http.StatusCreated,
+			setupMock:   func(m *MockDB) {},
+			wantStatus:  http.StatusCreated,
+			wantCalls:   1,
+			wantBody:    `{"id":1}`,
+		},
+		{
+			name:        "first use stores the response",
+			key:         "retry-1",
+			body:        body,
+			handlerCode: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("ClaimIdempotencyKey", mock.MatchedBy(func(r *models.IdempotencyRecord) bool {
+					return r.Scope == "POST /brands" && r.Key == "retry-1" && len(r.RequestHash) == 64
+				})).Return(nil, nil)
+				m.On("SaveIdempotentResponse", "POST /brands", "retry-1", http.StatusCreated, []byte("{\"id\":1}\n")).
+					Return(nil)
+			},
+			wantStatus: http.StatusCreated,
+			wantCalls:  1,
+			wantBody:   `{"id":1}`,
+		},
+		{
+			name: "retry replays the stored response",
+			key:  "retry-1",
+			body: body,
+			setupMock: func(m *MockDB) {
+				m.On("ClaimIdempotencyKey", mock.Anything).Return(&models.IdempotencyRecord{
+					RequestHash: hashOf(body), StatusCode: http.StatusCreated, Body: []byte(`{"id":1}`),
+				}, nil)
+			},
+			wantStatus: http.StatusCreated,
+			wantBody:   `{"id":1}`,
+			wantReplay: true,
+		},
+		{
+			name: "key reused with a different body",
+			key:  "retry-1",
+			body: otherBody,
+			setupMock: func(m *MockDB) {
+				m.On("ClaimIdempotencyKey", mock.Anything).Return(&models.IdempotencyRecord{
+					RequestHash: hashOf(body), StatusCode: http.StatusCreated, Body: []byte(`{"id":1}`),
+				}, nil)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "first request still running",
+			key:  "retry-1",
+			body: body,
+			setupMock: func(m *MockDB) {
+				m.On("ClaimIdempotencyKey", mock.Anything).Return(&models.IdempotencyRecord{
+					RequestHash: hashOf(body),
+				}, nil)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:        "server error is stored too",
+			key:         "retry-1",
+			body:        body,
+			handlerCode: http.StatusServiceUnavailable,
+			setupMock: func(m *MockDB) {
+				m.On("ClaimIdempotencyKey", mock.Anything).Return(nil, nil)
+				m.On("SaveIdempotentResponse", "POST /brands", "retry-1", http.StatusServiceUnavailable,
+					[]byte("{\"id\":1}\n")).Return(nil)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCalls:  1,
+			wantBody:   `{"id":1}`,
+		},
+		{
+			name:        "response that cannot be stored keeps the claim",
+			key:         "retry-1",
+			body:        body,
+			handlerCode: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("ClaimIdempotencyKey", mock.Anything).Return(nil, nil)
+				m.On("SaveIdempotentResponse", "POST /brands", "retry-1", http.StatusCreated, mock.Anything).
+					Return(database.ErrUnavailable)
+			},
+			wantStatus: http.StatusCreated,
+			wantCalls:  1,
+			wantBody:   `{"id":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			calls := 0
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				var req models.CreateBrandRequest
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				w.WriteHeader(tt.handlerCode)
+				json.NewEncoder(w).Encode(map[string]int{"id": 1})
+			})
+
+			req := httptest.NewRequest("POST", "/brands", bytes.NewBufferString(tt.body))
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			rec := httptest.NewRecorder()
+
+			NewHandler(mockDB).Idempotent(next).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantCalls, calls)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rec.Body.String())
+			}
+			assert.Equal(t, tt.wantReplay, rec.Header().Get("Idempotent-Replayed") == "true")
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func hashOf(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
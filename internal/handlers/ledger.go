@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetCustomerLedger handles retrieving the points history of a customer
+func (h *Handler) GetCustomerLedger(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid customer ID"))
+		return
+	}
+
+	if _, err := h.db.GetCustomer(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	entries, err := h.db.GetPointsLedger(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ReconcileCustomerPoints handles checking a customer's balance against the
+// sum of their ledger entries
+func (h *Handler) ReconcileCustomerPoints(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid customer ID"))
+		return
+	}
+
+	rec, err := h.db.ReconcileCustomerPoints(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rec)
+}
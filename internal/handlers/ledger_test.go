@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCustomerLedger(t *testing.T) {
+	tests := []struct {
+		name           string
+		customerID     string
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "customer with history",
+			customerID:     "1",
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 1).Return(&models.Customer{ID: 1, PointsBalance: 700}, nil)
+				m.On("GetPointsLedger", 1).Return([]models.PointsLedgerEntry{
+					{ID: 1, CustomerID: 1, EntryType: models.LedgerEarn, Amount: 1000, BalanceAfter: 1000},
+					{ID: 2, CustomerID: 1, EntryType: models.LedgerRedeem, Amount: -300, BalanceAfter: 700},
+				}, nil)
+			},
+		},
+		{
+			name:           "unknown customer",
+			customerID:     "999",
+			expectedStatus: http.StatusNotFound,
+			setupMock: func(m *MockDB) {
+				m.On("GetCustomer", 999).Return(nil, fmt.Errorf("customer 999: %w", database.ErrNotFound))
+			},
+		},
+		{
+			name:           "invalid customer ID",
+			customerID:     "abc",
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Get("/customers/{id}/ledger", handler.GetCustomerLedger)
+
+			req := httptest.NewRequest("GET", "/customers/"+tt.customerID+"/ledger", nil)
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
@@ -26,12 +26,27 @@ func (m *MockDB) GetBrand(id int) (*models.Brand, error) {
 	return args.Get(0).(*models.Brand), args.Error(1)
 }
 
-func (m *MockDB) ListBrands() ([]models.Brand, error) {
-	args := m.Called()
+func (m *MockDB) ListBrands(filter models.BrandFilter) (*models.Page[models.Brand], error) {
+	args := m.Called(filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]models.Brand), args.Error(1)
+	return args.Get(0).(*models.Page[models.Brand]), args.Error(1)
+}
+
+func (m *MockDB) UpdateBrand(brand *models.Brand) error {
+	args := m.Called(brand)
+	return args.Error(0)
+}
+
+func (m *MockDB) ArchiveBrand(id int) (int, error) {
+	args := m.Called(id)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockDB) RestoreBrand(id int) (int, error) {
+	args := m.Called(id)
+	return args.Int(0), args.Error(1)
 }
 
 func (m *MockDB) CreateVoucher(voucher *models.Voucher) (int, error) {
@@ -47,12 +62,48 @@ func (m *MockDB) GetVoucher(id int) (*models.Voucher, error) {
 	return args.Get(0).(*models.Voucher), args.Error(1)
 }
 
-func (m *MockDB) ListVouchers() ([]models.Voucher, error) {
-	args := m.Called()
+func (m *MockDB) ListVouchers(filter models.VoucherFilter) (*models.Page[models.Voucher], error) {
+	args := m.Called(filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]models.Voucher), args.Error(1)
+	return args.Get(0).(*models.Page[models.Voucher]), args.Error(1)
+}
+
+func (m *MockDB) UpdateVoucher(voucher *models.Voucher, setActive, setStock bool) error {
+	args := m.Called(voucher, setActive, setStock)
+	return args.Error(0)
+}
+
+func (m *MockDB) SetVoucherActive(id int, active bool) error {
+	args := m.Called(id, active)
+	return args.Error(0)
+}
+
+func (m *MockDB) DeleteVoucher(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockDB) RestockVoucher(id int, quantity int) (*models.Voucher, error) {
+	args := m.Called(id, quantity)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Voucher), args.Error(1)
+}
+
+func (m *MockDB) AddVoucherCodes(voucherID int, codes []string) (*models.VoucherCodePool, error) {
+	args := m.Called(voucherID, codes)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.VoucherCodePool), args.Error(1)
+}
+
+func (m *MockDB) CreateCustomer(customer *models.Customer) (int, error) {
+	args := m.Called(customer)
+	return args.Int(0), args.Error(1)
 }
 
 func (m *MockDB) GetCustomer(id int) (*models.Customer, error) {
@@ -63,6 +114,24 @@ func (m *MockDB) GetCustomer(id int) (*models.Customer, error) {
 	return args.Get(0).(*models.Customer), args.Error(1)
 }
 
+func (m *MockDB) ListCustomers() ([]models.Customer, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Customer), args.Error(1)
+}
+
+func (m *MockDB) UpdateCustomer(customer *models.Customer) error {
+	args := m.Called(customer)
+	return args.Error(0)
+}
+
+func (m *MockDB) DeactivateCustomer(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
 func (m *MockDB) CreateRedemption(redemption *models.Redemption) (int, error) {
 	args := m.Called(redemption)
 	return args.Int(0), args.Error(1)
@@ -76,11 +145,98 @@ func (m *MockDB) GetRedemption(id int) (*models.Redemption, error) {
 	return args.Get(0).(*models.Redemption), args.Error(1)
 }
 
-func (m *MockDB) UpdateCustomerPoints(customerID int, points int) error {
-	args := m.Called(customerID, points)
+func (m *MockDB) TransitionRedemption(id int, status string) (*models.Redemption, error) {
+	args := m.Called(id, status)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Redemption), args.Error(1)
+}
+
+func (m *MockDB) ListCustomerRedemptions(customerID int, filter models.RedemptionFilter) (*models.Page[models.Redemption], error) {
+	args := m.Called(customerID, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Page[models.Redemption]), args.Error(1)
+}
+
+func (m *MockDB) GetPointsLedger(customerID int) ([]models.PointsLedgerEntry, error) {
+	args := m.Called(customerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.PointsLedgerEntry), args.Error(1)
+}
+
+func (m *MockDB) CreditPoints(credits []models.PointsCredit) ([]models.PointsCreditResult, error) {
+	args := m.Called(credits)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.PointsCreditResult), args.Error(1)
+}
+
+func (m *MockDB) ReconcileCustomerPoints(customerID int) (*models.PointsReconciliation, error) {
+	args := m.Called(customerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PointsReconciliation), args.Error(1)
+}
+
+func (m *MockDB) ClaimIdempotencyKey(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	args := m.Called(record)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.IdempotencyRecord), args.Error(1)
+}
+
+func (m *MockDB) SaveIdempotentResponse(scope, key string, status int, body []byte) error {
+	args := m.Called(scope, key, status, body)
 	return args.Error(0)
 }
 
+func (m *MockDB) CreateAPIKey(key *models.APIKey, hash string) error {
+	args := m.Called(key, hash)
+	return args.Error(0)
+}
+
+func (m *MockDB) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	args := m.Called(hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (m *MockDB) ListAPIKeys() ([]models.APIKey, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (m *MockDB) RevokeAPIKey(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockDB) CreateTenant(tenant *models.Tenant) error {
+	args := m.Called(tenant)
+	return args.Error(0)
+}
+
+func (m *MockDB) ListTenants() ([]models.Tenant, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Tenant), args.Error(1)
+}
+
 func (m *MockDB) BeginTx() (*sql.Tx, error) {
 	args := m.Called()
 	if args.Get(0) == nil {
@@ -89,10 +245,10 @@ func (m *MockDB) BeginTx() (*sql.Tx, error) {
 	return args.Get(0).(*sql.Tx), args.Error(1)
 }
 
-func (m *MockDB) GetVouchersByBrand(brandID int) ([]models.Voucher, error) {
-	args := m.Called(brandID)
+func (m *MockDB) GetVouchersByBrand(brandID int, filter models.VoucherFilter) (*models.Page[models.Voucher], error) {
+	args := m.Called(brandID, filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).([]models.Voucher), args.Error(1)
+	return args.Get(0).(*models.Page[models.Voucher]), args.Error(1)
 }
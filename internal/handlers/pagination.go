@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+	"voucher-api/internal/models"
+)
+
+// pageRequest reads the sort, cursor and limit query parameters
+func pageRequest(q url.Values) (models.PageRequest, error) {
+	p := models.PageRequest{Sort: q.Get("sort"), Cursor: q.Get("cursor")}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return p, models.ErrInvalidPageSize
+		}
+		p.Limit = limit
+	}
+	return p, nil
+}
+
+// queryBool reads an optional true/false query parameter
+func queryBool(q url.Values, name string) (*bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, invalidRequest(name + " must be true or false")
+	}
+	return &b, nil
+}
+
+// queryInt reads an optional whole number query parameter
+func queryInt(q url.Values, name string) (*int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, invalidRequest(name + " must be a whole number")
+	}
+	return &n, nil
+}
+
+// queryTime reads an optional RFC 3339 time query parameter
+func queryTime(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, invalidRequest(name + " must be an RFC 3339 time")
+	}
+	return t, nil
+}
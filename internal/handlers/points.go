@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxCreditBatch bounds how many credits a single batch request may carry
+const maxCreditBatch = 100
+
+// CreditCustomerPoints handles awarding points to a single customer
+func (h *Handler) CreditCustomerPoints(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid customer ID"))
+		return
+	}
+
+	var credit models.PointsCredit
+	if err := json.NewDecoder(r.Body).Decode(&credit); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+	credit.CustomerID = id
+
+	if err := credit.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	results, err := h.db.CreditPoints([]models.PointsCredit{credit})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// A replayed key returns the original entry without crediting again
+	if !results[0].Duplicate {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(results[0])
+}
+
+// CreditPointsBatch handles awarding points to many customers at once. The
+// batch is applied atomically: if any credit fails, none are recorded.
+func (h *Handler) CreditPointsBatch(w http.ResponseWriter, r *http.Request) {
+	var req models.CreditPointsBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+
+	if len(req.Credits) == 0 {
+		writeError(w, r, invalidRequest("credits cannot be empty"))
+		return
+	}
+	if len(req.Credits) > maxCreditBatch {
+		writeError(w, r, invalidRequest(fmt.Sprintf("a batch may contain at most %d credits", maxCreditBatch)))
+		return
+	}
+	for i := range req.Credits {
+		if err := req.Credits[i].Validate(); err != nil {
+			writeError(w, r, fmt.Errorf("credit %d: %w", i, err))
+			return
+		}
+	}
+
+	results, err := h.db.CreditPoints(req.Credits)
+	if errors.Is(err, database.ErrNotFound) {
+		// A missing customer is a problem with the batch, not the URL
+		writeError(w, r, &APIError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    CodeNotFound,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string][]models.PointsCreditResult{"results": results})
+}
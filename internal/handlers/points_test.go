@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreditCustomerPoints(t *testing.T) {
+	validBody := map[string]interface{}{
+		"points":             250,
+		"source":             "pos",
+		"external_reference": "order-42",
+		"idempotency_key":    "pos-order-42",
+	}
+
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "new credit",
+			requestBody:    validBody,
+			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("CreditPoints", mock.MatchedBy(func(c []models.PointsCredit) bool {
+					return len(c) == 1 && c[0].CustomerID == 1 && c[0].Points == 250
+				})).Return([]models.PointsCreditResult{{Entry: models.PointsLedgerEntry{ID: 9}}}, nil)
+			},
+		},
+		{
+			name:           "replayed credit",
+			requestBody:    validBody,
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("CreditPoints", mock.Anything).
+					Return([]models.PointsCreditResult{{Entry: models.PointsLedgerEntry{ID: 9}, Duplicate: true}}, nil)
+			},
+		},
+		{
+			name:           "key reused for different credit",
+			requestBody:    validBody,
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("CreditPoints", mock.Anything).
+					Return(nil, fmt.Errorf("credit 0: %w", models.ErrIdempotencyConflict))
+			},
+		},
+		{
+			name:           "unknown customer",
+			requestBody:    validBody,
+			expectedStatus: http.StatusNotFound,
+			setupMock: func(m *MockDB) {
+				m.On("CreditPoints", mock.Anything).Return(nil, fmt.Errorf("credit 0: customer 1: %w", database.ErrNotFound))
+			},
+		},
+		{
+			name: "missing idempotency key",
+			requestBody: map[string]interface{}{
+				"points": 250,
+				"source": "pos",
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name: "negative points",
+			requestBody: map[string]interface{}{
+				"points":          -5,
+				"source":          "pos",
+				"idempotency_key": "pos-order-42",
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Post("/customers/{id}/points", handler.CreditCustomerPoints)
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/customers/1/points", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCreditPointsBatch(t *testing.T) {
+	credit := func(customerID int, key string) map[string]interface{} {
+		return map[string]interface{}{
+			"customer_id":     customerID,
+			"points":          100,
+			"source":          "ecommerce",
+			"idempotency_key": key,
+		}
+	}
+
+	tests := []struct {
+		name           string
+		credits        []map[string]interface{}
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "valid batch",
+			credits:        []map[string]interface{}{credit(1, "a"), credit(2, "b")},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("CreditPoints", mock.MatchedBy(func(c []models.PointsCredit) bool {
+					return len(c) == 2
+				})).Return([]models.PointsCreditResult{{}, {}}, nil)
+			},
+		},
+		{
+			name:           "empty batch",
+			credits:        []map[string]interface{}{},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "invalid credit rejects the whole batch",
+			credits:        []map[string]interface{}{credit(1, "a"), credit(0, "b")},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "unknown customer in batch",
+			credits:        []map[string]interface{}{credit(1, "a"), credit(999, "b")},
+			expectedStatus: http.StatusUnprocessableEntity,
+			setupMock: func(m *MockDB) {
+				m.On("CreditPoints", mock.Anything).Return(nil, fmt.Errorf("credit 1: customer 999: %w", database.ErrNotFound))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Post("/points/credits", handler.CreditPointsBatch)
+
+			body, _ := json.Marshal(map[string]interface{}{"credits": tt.credits})
+			req := httptest.NewRequest("POST", "/points/credits", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"voucher-api/internal/auth"
+	"voucher-api/internal/models"
+)
+
+// SetTenantScope sets how to get a Database limited to one tenant's brands
+// and vouchers. Until it is set, keys that belong to a tenant are refused.
+func (h *Handler) SetTenantScope(forTenant func(tenantID int) Database) {
+	h.forTenant = forTenant
+}
+
+// store returns the Database brand and voucher handlers should use for r:
+// scoped to the tenant when the client is a tenant's key, so other tenants'
+// records are not found, and the whole database otherwise
+func (h *Handler) store(r *http.Request) Database {
+	if principal, ok := auth.FromContext(r.Context()); ok && principal.TenantID != 0 {
+		return h.forTenant(principal.TenantID)
+	}
+	return h.db
+}
+
+// CreateTenant handles adding a tenant
+func (h *Handler) CreateTenant(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateTenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+
+	tenant := &models.Tenant{Name: req.Name}
+	if err := tenant.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.db.CreateTenant(tenant); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tenant)
+}
+
+// ListTenants handles retrieving all tenants
+func (h *Handler) ListTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := h.db.ListTenants()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tenants)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"voucher-api/internal/auth"
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTenantKeys(t *testing.T) {
+	tenantID := 3
+	tenantKey := &models.APIKey{ID: 8, TenantID: &tenantID, Name: "acme", Scopes: []string{models.ScopeBrandManager, models.ScopeRead}}
+	platformKey := &models.APIKey{ID: 2, Name: "backoffice", Scopes: []string{models.ScopeAdmin}}
+
+	tests := []struct {
+		name       string
+		key        *models.APIKey
+		path       string
+		noScope    bool
+		setupMock  func(db, scoped *MockDB)
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name: "tenant key reads its own brand",
+			key:  tenantKey,
+			path: "/brands/5",
+			setupMock: func(db, scoped *MockDB) {
+				scoped.On("GetBrand", 5).Return(&models.Brand{ID: 5, TenantID: &tenantID, Name: "Acme"}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "other tenant's brand is not found",
+			key:  tenantKey,
+			path: "/brands/6",
+			setupMock: func(db, scoped *MockDB) {
+				scoped.On("GetBrand", 6).Return(nil, database.ErrNotFound)
+			},
+			wantStatus: http.StatusNotFound,
+			wantCode:   CodeNotFound,
+		},
+		{
+			name: "platform key sees every brand",
+			key:  platformKey,
+			path: "/brands/6",
+			setupMock: func(db, scoped *MockDB) {
+				db.On("GetBrand", 6).Return(&models.Brand{ID: 6, Name: "Other"}, nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "tenant key cannot reach customers",
+			key:        tenantKey,
+			path:       "/customers",
+			setupMock:  func(db, scoped *MockDB) {},
+			wantStatus: http.StatusForbidden,
+			wantCode:   CodeForbidden,
+		},
+		{
+			name:       "tenant key refused without tenant scoping",
+			key:        tenantKey,
+			path:       "/brands/5",
+			noScope:    true,
+			setupMock:  func(db, scoped *MockDB) {},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, scoped := new(MockDB), new(MockDB)
+			db.On("GetAPIKeyByHash", auth.HashKey("vk_test")).Return(tt.key, nil)
+			tt.setupMock(db, scoped)
+
+			h := NewHandler(db)
+			if !tt.noScope {
+				h.SetTenantScope(func(id int) Database {
+					assert.Equal(t, tenantID, id)
+					return scoped
+				})
+			}
+			router := chi.NewRouter()
+			router.Use(h.Authenticate)
+			router.Get("/brands/{id}", h.GetBrand)
+			router.With(h.RequirePlatform).Get("/customers", h.ListCustomers)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set(APIKeyHeader, "vk_test")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantCode != "" {
+				var resp ErrorResponse
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+				assert.Equal(t, tt.wantCode, resp.Error.Code)
+			}
+			db.AssertExpectations(t)
+			scoped.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCreateTenant(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		setupMock  func(*MockDB)
+		wantStatus int
+	}{
+		{
+			name: "creates the tenant",
+			body: `{"name":"Acme"}`,
+			setupMock: func(m *MockDB) {
+				m.On("CreateTenant", mock.MatchedBy(func(t *models.Tenant) bool { return t.Name == "Acme" })).
+					Run(func(args mock.Arguments) { args.Get(0).(*models.Tenant).ID = 3 }).
+					Return(nil)
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "missing name",
+			body:       `{"name":" "}`,
+			setupMock:  func(m *MockDB) {},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+			router := chi.NewRouter()
+			router.Post("/tenants", NewHandler(mockDB).CreateTenant)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("POST", "/tenants", bytes.NewBufferString(tt.body)))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusCreated {
+				var tenant models.Tenant
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&tenant))
+				assert.Equal(t, 3, tenant.ID)
+			}
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"voucher-api/internal/codegen"
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// UpdateVoucher handles replacing a voucher's editable fields
+func (h *Handler) UpdateVoucher(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid voucher ID"))
+		return
+	}
+
+	var req models.UpdateVoucherRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+
+	voucher, err := h.store(r).GetVoucher(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	voucher.Code = req.Code
+	voucher.Name = req.Name
+	voucher.Description = req.Description
+	voucher.PointsCost = req.PointsCost
+	voucher.PerCustomerLimit = req.PerCustomerLimit
+	voucher.LimitPeriod = req.LimitPeriod
+	voucher.IsActive = req.IsActive
+	voucher.ValidFrom = req.ValidFrom
+	voucher.ValidUntil = req.ValidUntil
+	h.saveVoucher(w, r, voucher, true, true, false)
+}
+
+// PatchVoucher handles changing some of a voucher's fields
+func (h *Handler) PatchVoucher(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid voucher ID"))
+		return
+	}
+
+	var req models.PatchVoucherRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+
+	voucher, err := h.store(r).GetVoucher(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	req.Apply(voucher)
+	h.saveVoucher(w, r, voucher, req.IsActive != nil, req.ValidUntil.Set, req.TotalStock.Set)
+}
+
+// saveVoucher validates and stores an edited voucher, then writes it back.
+// setActive is whether the request chose whether the voucher is active,
+// setExpiry whether it set valid_until and setStock whether it set
+// total_stock.
+func (h *Handler) saveVoucher(w http.ResponseWriter, r *http.Request, voucher *models.Voucher,
+	setActive, setExpiry, setStock bool) {
+	if err := voucher.ValidateEdit(setExpiry); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.store(r).UpdateVoucher(voucher, setActive, setStock); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(voucher)
+}
+
+// ActivateVoucher handles making a voucher redeemable again
+func (h *Handler) ActivateVoucher(w http.ResponseWriter, r *http.Request) {
+	h.setVoucherActive(w, r, true)
+}
+
+// DeactivateVoucher handles stopping a voucher from being redeemed. Unlike
+// an update this does not revalidate the voucher, so expired vouchers can be
+// switched off too.
+func (h *Handler) DeactivateVoucher(w http.ResponseWriter, r *http.Request) {
+	h.setVoucherActive(w, r, false)
+}
+
+func (h *Handler) setVoucherActive(w http.ResponseWriter, r *http.Request, active bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid voucher ID"))
+		return
+	}
+
+	voucher, err := h.store(r).GetVoucher(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := h.store(r).SetVoucherActive(id, active); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	voucher.IsActive = active
+	json.NewEncoder(w).Encode(voucher)
+}
+
+// DeleteVoucher handles removing a voucher. Redemptions that already include
+// it are unaffected.
+func (h *Handler) DeleteVoucher(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid voucher ID"))
+		return
+	}
+
+	if err := h.store(r).DeleteVoucher(id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestockVoucher handles adding units to a voucher with limited stock
+func (h *Handler) RestockVoucher(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid voucher ID"))
+		return
+	}
+
+	var req models.RestockVoucherRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+	if req.Quantity <= 0 {
+		writeError(w, r, models.ErrInvalidQuantity)
+		return
+	}
+
+	voucher, err := h.store(r).RestockVoucher(id, req.Quantity)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(voucher)
+}
+
+// maxCodeUpload bounds how many codes a single upload may carry
+const maxCodeUpload = 1000
+
+// maxCodeLength matches the width of the voucher_codes.code column
+const maxCodeLength = 100
+
+// AddVoucherCodes handles uploading single-use codes to a voucher's pool.
+// Once a voucher has a pool, every unit redeemed is given one of its codes.
+func (h *Handler) AddVoucherCodes(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid voucher ID"))
+		return
+	}
+
+	var req models.AddVoucherCodesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+
+	if len(req.Codes) == 0 {
+		writeError(w, r, invalidRequest("codes cannot be empty"))
+		return
+	}
+	if len(req.Codes) > maxCodeUpload {
+		writeError(w, r, invalidRequest(fmt.Sprintf("an upload may contain at most %d codes", maxCodeUpload)))
+		return
+	}
+	// Codes compare case-insensitively once stored, so duplicates are found
+	// the same way
+	seen := make(map[string]bool, len(req.Codes))
+	for i, code := range req.Codes {
+		code = strings.TrimSpace(code)
+		switch {
+		case code == "":
+			err = models.ErrEmptyCode
+		case len(code) > maxCodeLength:
+			err = models.ErrCodeTooLong
+		case seen[strings.ToUpper(code)]:
+			err = models.ErrDuplicateCode
+		}
+		if err != nil {
+			writeError(w, r, fmt.Errorf("code %d: %w", i, err))
+			return
+		}
+		seen[strings.ToUpper(code)] = true
+		req.Codes[i] = code
+	}
+
+	pool, err := h.store(r).AddVoucherCodes(id, req.Codes)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pool)
+}
+
+// generateAttempts bounds how often a batch of generated codes is redrawn
+// after colliding with codes already stored
+const generateAttempts = 3
+
+// GenerateVoucherCodes handles generating new codes into a voucher's pool.
+// The codes are returned so they can be handed out.
+func (h *Handler) GenerateVoucherCodes(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, invalidRequest("invalid voucher ID"))
+		return
+	}
+
+	var req models.GenerateVoucherCodesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, invalidRequest(err.Error()))
+		return
+	}
+
+	if req.Count <= 0 {
+		writeError(w, r, models.ErrInvalidQuantity)
+		return
+	}
+	if req.Count > maxCodeUpload {
+		writeError(w, r, invalidRequest(fmt.Sprintf("at most %d codes may be generated at once", maxCodeUpload)))
+		return
+	}
+	pattern := codegen.Pattern{Prefix: req.Prefix, Length: req.Length, Alphabet: req.Alphabet}.WithDefaults()
+	if err := pattern.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := pattern.ValidateCount(req.Count); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if pattern.CodeLength() > maxCodeLength {
+		writeError(w, r, models.ErrCodeTooLong)
+		return
+	}
+
+	// A collision with a stored code rejects the whole batch, so draw a
+	// fresh one. With the default pattern this is vanishingly rare.
+	var pool *models.VoucherCodePool
+	var codes []string
+	for attempt := 1; ; attempt++ {
+		codes, err = pattern.GenerateUnique(req.Count)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		pool, err = h.store(r).AddVoucherCodes(id, codes)
+		if !errors.Is(err, database.ErrConflict) || attempt == generateAttempts {
+			break
+		}
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	pool.Codes = codes
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pool)
+}
+
+// voucherFilter reads the voucher list filters, sort and page from the query
+// string
+func voucherFilter(r *http.Request) (models.VoucherFilter, error) {
+	q := r.URL.Query()
+	var filter models.VoucherFilter
+	var err error
+
+	excludeExpired, err := queryBool(q, "exclude_expired")
+	if err != nil {
+		return filter, err
+	}
+	filter.ExcludeExpired = excludeExpired != nil && *excludeExpired
+	if filter.Active, err = queryBool(q, "active"); err != nil {
+		return filter, err
+	}
+	if brandID, err := queryInt(q, "brand_id"); err != nil {
+		return filter, err
+	} else if brandID != nil {
+		filter.BrandID = *brandID
+	}
+	if filter.ExpiresBefore, err = queryTime(q, "expires_before"); err != nil {
+		return filter, err
+	}
+	if filter.MinPoints, err = queryInt(q, "min_points"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPoints, err = queryInt(q, "max_points"); err != nil {
+		return filter, err
+	}
+	filter.Search = q.Get("q")
+	if filter.PageRequest, err = pageRequest(q); err != nil {
+		return filter, err
+	}
+	return filter, filter.Validate()
+}
@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"voucher-api/internal/codegen"
+	"voucher-api/internal/database"
+	"voucher-api/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func existingVoucher() *models.Voucher {
+	return &models.Voucher{
+		ID:          1,
+		BrandID:     1,
+		Code:        "SAVE10",
+		Name:        "Save 10",
+		Description: "Ten off",
+		PointsCost:  100,
+		IsActive:    true,
+	}
+}
+
+func TestUpdateVoucher(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		voucherID      string
+		requestBody    map[string]interface{}
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:      "replace all fields",
+			method:    "PUT",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"code":        "SAVE20",
+				"name":        "Save 20",
+				"points_cost": 200,
+				"is_active":   true,
+			},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("GetVoucher", 1).Return(existingVoucher(), nil)
+				m.On("UpdateVoucher", mock.MatchedBy(func(v *models.Voucher) bool {
+					return v.Code == "SAVE20" && v.PointsCost == 200 && v.Description == "" && v.BrandID == 1
+				}), true, false).Return(nil)
+			},
+		},
+		{
+			name:      "patch keeps absent fields",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"points_cost": 150,
+			},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("GetVoucher", 1).Return(existingVoucher(), nil)
+				m.On("UpdateVoucher", mock.MatchedBy(func(v *models.Voucher) bool {
+					return v.Code == "SAVE10" && v.PointsCost == 150 && v.Description == "Ten off" && v.IsActive
+				}), false, false).Return(nil)
+			},
+		},
+		{
+			name:      "patch with invalid result",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"points_cost": 0,
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock: func(m *MockDB) {
+				m.On("GetVoucher", 1).Return(existingVoucher(), nil)
+			},
+		},
+		{
+			name:      "patch renames an expired voucher",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"name": "Save 10 (ended)",
+			},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				expired := existingVoucher()
+				expired.ValidUntil = time.Now().Add(-24 * time.Hour)
+				m.On("GetVoucher", 1).Return(expired, nil)
+				m.On("UpdateVoucher", mock.MatchedBy(func(v *models.Voucher) bool {
+					return v.Name == "Save 10 (ended)"
+				}), false, false).Return(nil)
+			},
+		},
+		{
+			name:      "patch sets an expiry in the past",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"valid_until": time.Now().Add(-24 * time.Hour),
+			},
+			expectedStatus: http.StatusBadRequest,
+			setupMock: func(m *MockDB) {
+				m.On("GetVoucher", 1).Return(existingVoucher(), nil)
+			},
+		},
+		{
+			name:      "code taken by another voucher",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"code": "TAKEN",
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("GetVoucher", 1).Return(existingVoucher(), nil)
+				m.On("UpdateVoucher", mock.Anything, false, false).
+					Return(fmt.Errorf("%w: voucher code %q already exists", database.ErrConflict, "TAKEN"))
+			},
+		},
+		{
+			name:      "patch null removes the per-customer limit",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"per_customer_limit": nil,
+			},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				limited := existingVoucher()
+				limit := 1
+				limited.PerCustomerLimit = &limit
+				limited.LimitPeriod = models.PeriodDay
+				m.On("GetVoucher", 1).Return(limited, nil)
+				m.On("UpdateVoucher", mock.MatchedBy(func(v *models.Voucher) bool {
+					return v.PerCustomerLimit == nil && v.LimitPeriod == ""
+				}), false, false).Return(nil)
+			},
+		},
+		{
+			name:      "patch null removes the validity dates",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"valid_from":  nil,
+				"valid_until": nil,
+			},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				dated := existingVoucher()
+				dated.ValidFrom = time.Now().Add(-24 * time.Hour)
+				dated.ValidUntil = time.Now().Add(24 * time.Hour)
+				m.On("GetVoucher", 1).Return(dated, nil)
+				m.On("UpdateVoucher", mock.MatchedBy(func(v *models.Voucher) bool {
+					return v.ValidFrom.IsZero() && v.ValidUntil.IsZero()
+				}), false, false).Return(nil)
+			},
+		},
+		{
+			name:      "patch sets a stock limit",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"total_stock": 50,
+			},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("GetVoucher", 1).Return(existingVoucher(), nil)
+				m.On("UpdateVoucher", mock.MatchedBy(func(v *models.Voucher) bool {
+					return v.TotalStock != nil && *v.TotalStock == 50
+				}), false, true).Return(nil)
+			},
+		},
+		{
+			name:      "patch deactivating overrides archiving",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"is_active": false,
+			},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				m.On("GetVoucher", 1).Return(existingVoucher(), nil)
+				m.On("UpdateVoucher", mock.MatchedBy(func(v *models.Voucher) bool { return !v.IsActive }), true, false).
+					Return(nil)
+			},
+		},
+		{
+			name:      "reactivate under archived brand",
+			method:    "PATCH",
+			voucherID: "1",
+			requestBody: map[string]interface{}{
+				"is_active": true,
+			},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("GetVoucher", 1).Return(existingVoucher(), nil)
+				m.On("UpdateVoucher", mock.Anything, true, false).Return(models.ErrBrandArchived)
+			},
+		},
+		{
+			name:      "unknown voucher",
+			method:    "PUT",
+			voucherID: "999",
+			requestBody: map[string]interface{}{
+				"code":        "SAVE10",
+				"name":        "Save 10",
+				"points_cost": 100,
+			},
+			expectedStatus: http.StatusNotFound,
+			setupMock: func(m *MockDB) {
+				m.On("GetVoucher", 999).Return(nil, fmt.Errorf("voucher 999: %w", database.ErrNotFound))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Put("/vouchers/{id}", handler.UpdateVoucher)
+			router.Patch("/vouchers/{id}", handler.PatchVoucher)
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest(tt.method, "/vouchers/"+tt.voucherID, bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeactivateVoucher(t *testing.T) {
+	mockDB := new(MockDB)
+	mockDB.On("GetVoucher", 1).Return(existingVoucher(), nil)
+	mockDB.On("SetVoucherActive", 1, false).Return(nil)
+
+	handler := NewHandler(mockDB)
+	router := chi.NewRouter()
+	router.Post("/vouchers/{id}/deactivate", handler.DeactivateVoucher)
+
+	req := httptest.NewRequest("POST", "/vouchers/1/deactivate", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	var voucher models.Voucher
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&voucher))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, voucher.IsActive)
+	mockDB.AssertExpectations(t)
+}
+
+func TestDeleteVoucher(t *testing.T) {
+	tests := []struct {
+		name           string
+		voucherID      string
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "delete voucher",
+			voucherID:      "1",
+			expectedStatus: http.StatusNoContent,
+			setupMock: func(m *MockDB) {
+				m.On("DeleteVoucher", 1).Return(nil)
+			},
+		},
+		{
+			name:           "already deleted",
+			voucherID:      "1",
+			expectedStatus: http.StatusNotFound,
+			setupMock: func(m *MockDB) {
+				m.On("DeleteVoucher", 1).Return(fmt.Errorf("voucher 1: %w", database.ErrNotFound))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Delete("/vouchers/{id}", handler.DeleteVoucher)
+
+			req := httptest.NewRequest("DELETE", "/vouchers/"+tt.voucherID, nil)
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRestockVoucher(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "restock",
+			requestBody:    map[string]interface{}{"quantity": 50},
+			expectedStatus: http.StatusOK,
+			setupMock: func(m *MockDB) {
+				total, remaining := 150, 60
+				m.On("RestockVoucher", 1, 50).
+					Return(&models.Voucher{ID: 1, TotalStock: &total, RemainingStock: &remaining}, nil)
+			},
+		},
+		{
+			name:           "quantity must be positive",
+			requestBody:    map[string]interface{}{"quantity": 0},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "unlimited voucher",
+			requestBody:    map[string]interface{}{"quantity": 10},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("RestockVoucher", 1, 10).Return(nil, fmt.Errorf("voucher 1: %w", models.ErrStockNotLimited))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Post("/vouchers/{id}/restock", handler.RestockVoucher)
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/vouchers/1/restock", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAddVoucherCodes(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "upload trimmed codes",
+			requestBody:    map[string]interface{}{"codes": []string{" GIFT-1 ", "GIFT-2"}},
+			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("AddVoucherCodes", 1, []string{"GIFT-1", "GIFT-2"}).
+					Return(&models.VoucherCodePool{VoucherID: 1, Added: 2, Available: 2}, nil)
+			},
+		},
+		{
+			name:           "no codes",
+			requestBody:    map[string]interface{}{"codes": []string{}},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "duplicate within upload",
+			requestBody:    map[string]interface{}{"codes": []string{"GIFT-1", "GIFT-1 "}},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "duplicate differing only in case",
+			requestBody:    map[string]interface{}{"codes": []string{"GIFT-A", "gift-a"}},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "code already in a pool",
+			requestBody:    map[string]interface{}{"codes": []string{"GIFT-1"}},
+			expectedStatus: http.StatusConflict,
+			setupMock: func(m *MockDB) {
+				m.On("AddVoucherCodes", 1, []string{"GIFT-1"}).
+					Return(nil, fmt.Errorf("%w: one or more codes already exist", database.ErrConflict))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Post("/vouchers/{id}/codes", handler.AddVoucherCodes)
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/vouchers/1/codes", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGenerateVoucherCodes(t *testing.T) {
+	pattern := codegen.Pattern{Prefix: "GIFT-"}.WithDefaults()
+	generated := mock.MatchedBy(func(codes []string) bool {
+		for _, code := range codes {
+			if !pattern.Check(code) {
+				return false
+			}
+		}
+		return len(codes) == 5
+	})
+
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		expectedStatus int
+		setupMock      func(*MockDB)
+	}{
+		{
+			name:           "generate codes",
+			requestBody:    map[string]interface{}{"count": 5, "prefix": "GIFT-"},
+			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("AddVoucherCodes", 1, generated).
+					Return(&models.VoucherCodePool{VoucherID: 1, Added: 5, Available: 5}, nil)
+			},
+		},
+		{
+			name:           "redraws after a collision",
+			requestBody:    map[string]interface{}{"count": 5, "prefix": "GIFT-"},
+			expectedStatus: http.StatusCreated,
+			setupMock: func(m *MockDB) {
+				m.On("AddVoucherCodes", 1, generated).
+					Return(nil, fmt.Errorf("%w: one or more codes already exist", database.ErrConflict)).Once()
+				m.On("AddVoucherCodes", 1, generated).
+					Return(&models.VoucherCodePool{VoucherID: 1, Added: 5, Available: 5}, nil).Once()
+			},
+		},
+		{
+			name:           "ambiguous alphabet",
+			requestBody:    map[string]interface{}{"count": 5, "alphabet": "ABC0"},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "alphabet too small for the count",
+			requestBody:    map[string]interface{}{"count": 17, "alphabet": "AB", "length": 4},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+		{
+			name:           "count must be positive",
+			requestBody:    map[string]interface{}{"count": 0},
+			expectedStatus: http.StatusBadRequest,
+			setupMock:      func(m *MockDB) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDB)
+			tt.setupMock(mockDB)
+
+			handler := NewHandler(mockDB)
+			router := chi.NewRouter()
+			router.Post("/vouchers/{id}/codes/generate", handler.GenerateVoucherCodes)
+
+			body, _ := json.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/vouchers/1/codes/generate", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if rec.Code == http.StatusCreated {
+				var pool models.VoucherCodePool
+				assert.NoError(t, json.NewDecoder(rec.Body).Decode(&pool))
+				assert.Len(t, pool.Codes, 5)
+			}
+			mockDB.AssertExpectations(t)
+		})
+	}
+}
@@ -1,50 +1,291 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
 	"strings"
 	"time"
 )
 
 var (
-	ErrEmptyName         = errors.New("name cannot be empty")
-	ErrEmptyCode         = errors.New("code cannot be empty")
-	ErrInvalidPointsCost = errors.New("points cost must be positive")
-	ErrInvalidEmail      = errors.New("invalid email format")
-	ErrNegativePoints    = errors.New("points balance cannot be negative")
-	ErrExpiredVoucher    = errors.New("voucher has expired")
-	ErrNoItems           = errors.New("redemption must have at least one item")
-	ErrInvalidStatus     = errors.New("invalid redemption status")
+	ErrEmptyName           = errors.New("name cannot be empty")
+	ErrEmptyCode           = errors.New("code cannot be empty")
+	ErrInvalidPointsCost   = errors.New("points cost must be positive")
+	ErrInvalidEmail        = errors.New("invalid email format")
+	ErrNegativePoints      = errors.New("points balance cannot be negative")
+	ErrExpiredVoucher      = errors.New("voucher has expired")
+	ErrNoItems             = errors.New("redemption must have at least one item")
+	ErrInvalidStatus       = errors.New("invalid redemption status")
+	ErrInsufficientPoints  = errors.New("insufficient points")
+	ErrInvalidEntryType    = errors.New("invalid ledger entry type")
+	ErrZeroAmount          = errors.New("amount cannot be zero")
+	ErrEmailTaken          = errors.New("email is already in use")
+	ErrInvalidPoints       = errors.New("points must be positive")
+	ErrEmptySource         = errors.New("source cannot be empty")
+	ErrEmptyIdempotencyKey = errors.New("idempotency key cannot be empty")
+	ErrIdempotencyConflict = errors.New("idempotency key was already used for a different request")
+	ErrIdempotencyPending  = errors.New("a request with this idempotency key is still being processed")
+	ErrInvalidCursor       = errors.New("cursor is malformed or belongs to a different sort")
+	ErrInvalidSort         = errors.New("list cannot be sorted by that field")
+	ErrInvalidPageSize     = errors.New("limit must be between 1 and 200")
+	ErrInvalidPointsRange  = errors.New("min_points cannot be more than max_points")
+	ErrInvalidDateRange    = errors.New("from must be before to")
+	ErrNoScopes            = errors.New("API key needs at least one scope")
+	ErrInvalidScope        = errors.New("scope must be admin, brand-manager, redeem or read")
+	ErrTenantScope         = errors.New("tenant keys can only have the brand-manager and read scopes")
+	ErrInvalidCustomerID   = errors.New("customer id must be positive")
+	ErrInvalidTransition   = errors.New("redemption cannot move to the requested status")
+	ErrVoucherInactive     = errors.New("voucher is not active")
+	ErrCustomerInactive    = errors.New("customer is not active")
+	ErrBrandArchived       = errors.New("brand is archived")
+	ErrVoucherNotYetValid  = errors.New("voucher is not valid yet")
+	ErrInvalidValidity     = errors.New("valid_from must be before valid_until")
+	ErrOutOfStock          = errors.New("voucher is out of stock")
+	ErrInvalidStock        = errors.New("stock cannot be negative")
+	ErrInvalidQuantity     = errors.New("quantity must be positive")
+	ErrQuantityTooLarge    = errors.New("quantity cannot be more than 100")
+	ErrTooManyItems        = errors.New("redemption cannot have more than 50 items")
+	ErrInvalidVoucherID    = errors.New("voucher id must be positive")
+	ErrMixedItems          = errors.New("use either items or voucher_ids, not both")
+	ErrStockNotLimited     = errors.New("voucher stock is not limited")
+	ErrLimitReached        = errors.New("customer has reached the redemption limit for this voucher")
+	ErrInvalidLimit        = errors.New("per customer limit must be positive")
+	ErrInvalidLimitPeriod  = errors.New("limit period must be day, week, month or year")
+	ErrDuplicateCode       = errors.New("codes must be unique")
+	ErrCodeTooLong         = errors.New("code cannot be longer than 100 characters")
 )
 
+// FieldError is one problem with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	err     error
+}
+
+// ValidationErrors collects every problem found in a request so they can all
+// be reported at once. errors.Is matches any of the collected errors.
+type ValidationErrors []FieldError
+
+// Add records that field failed with err
+func (e *ValidationErrors) Add(field string, err error) {
+	*e = append(*e, FieldError{Field: field, Message: err.Error(), err: err})
+}
+
+// Err returns e as an error, or nil when nothing was recorded
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe.err
+	}
+	return errs
+}
+
 type Brand struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	TenantID    *int       `json:"tenant_id,omitempty"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// IsArchived reports whether the brand has left the program
+func (b *Brand) IsArchived() bool {
+	return b.ArchivedAt != nil
 }
 
 func (b *Brand) Validate() error {
 	return validateBrandInternal(*b)
 }
 
+// Voucher is something customers can spend points on. TotalStock and
+// RemainingStock are nil when the voucher can be redeemed without limit.
+// PerCustomerLimit caps how many units one customer may redeem within
+// LimitPeriod, or over all time when LimitPeriod is empty. CodePool is set
+// once single-use codes have been uploaded; each redeemed unit then receives
+// one of them.
 type Voucher struct {
-	ID          int       `json:"id"`
-	BrandID     int       `json:"brand_id"`
-	Code        string    `json:"code"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	PointsCost  int       `json:"points_cost"`
-	IsActive    bool      `json:"is_active"`
-	ValidUntil  time.Time `json:"valid_until"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID               int       `json:"id"`
+	BrandID          int       `json:"brand_id"`
+	Code             string    `json:"code"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	PointsCost       int       `json:"points_cost"`
+	TotalStock       *int      `json:"total_stock"`
+	RemainingStock   *int      `json:"remaining_stock"`
+	PerCustomerLimit *int      `json:"per_customer_limit"`
+	LimitPeriod      string    `json:"limit_period,omitempty"`
+	CodePool         bool      `json:"code_pool"`
+	IsActive         bool      `json:"is_active"`
+	ValidFrom        time.Time `json:"valid_from"`
+	ValidUntil       time.Time `json:"valid_until"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 func (v *Voucher) Validate() error {
-	return validateVoucherInternal(*v)
+	return validateVoucherInternal(*v, true)
+}
+
+// ValidateEdit checks an edited voucher. An expiry in the past is only
+// rejected when the edit sets it, so an expired voucher's other fields can
+// still be changed.
+func (v *Voucher) ValidateEdit(setsExpiry bool) error {
+	return validateVoucherInternal(*v, setsExpiry)
+}
+
+// InStock reports whether quantity units of the voucher are left
+func (v *Voucher) InStock(quantity int) bool {
+	return v.RemainingStock == nil || *v.RemainingStock >= quantity
+}
+
+// AllowsQuantity reports whether a customer who already redeemed prior units
+// of the voucher within its limit period may redeem quantity more
+func (v *Voucher) AllowsQuantity(prior, quantity int) bool {
+	return v.PerCustomerLimit == nil || prior+quantity <= *v.PerCustomerLimit
+}
+
+// CheckRedeemable reports why the voucher cannot be redeemed at the given
+// time, or nil if it can. Zero validity dates leave that side open.
+func (v *Voucher) CheckRedeemable(at time.Time) error {
+	if !v.IsActive {
+		return ErrVoucherInactive
+	}
+	if !v.ValidFrom.IsZero() && at.Before(v.ValidFrom) {
+		return ErrVoucherNotYetValid
+	}
+	if !v.ValidUntil.IsZero() && !at.Before(v.ValidUntil) {
+		return ErrExpiredVoucher
+	}
+	return nil
+}
+
+// Per-customer limit periods
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodYear  = "year"
+)
+
+// LimitWindowStart returns when the limit period ending at now began. Periods
+// are rolling rather than calendar-aligned; an empty period means all time
+// and returns the zero time.
+func LimitWindowStart(period string, now time.Time) time.Time {
+	switch period {
+	case PeriodDay:
+		return now.AddDate(0, 0, -1)
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7)
+	case PeriodMonth:
+		return now.AddDate(0, -1, 0)
+	case PeriodYear:
+		return now.AddDate(-1, 0, 0)
+	}
+	return time.Time{}
+}
+
+// Page sizes for list endpoints
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// PageRequest selects one page of a list. Sort names the column to order by,
+// prefixed with "-" for descending order; empty means by ID. Cursor is the
+// NextCursor of the previous page, empty for the first page, and Limit is the
+// page size, zero meaning DefaultPageSize.
+type PageRequest struct {
+	Sort   string
+	Cursor string
+	Limit  int
+}
+
+// Validate checks the page size
+func (p *PageRequest) Validate() error {
+	if p.Limit < 0 || p.Limit > MaxPageSize {
+		return ErrInvalidPageSize
+	}
+	return nil
+}
+
+// Page is one page of a list. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// VoucherFilter narrows voucher lists. Zero values do not filter.
+type VoucherFilter struct {
+	// ExcludeExpired drops vouchers whose valid_until has passed
+	ExcludeExpired bool
+	BrandID        int
+	Active         *bool
+	// ExpiresBefore keeps vouchers with a valid_until before it
+	ExpiresBefore time.Time
+	MinPoints     *int
+	MaxPoints     *int
+	// Search matches part of the voucher name
+	Search string
+	PageRequest
+}
+
+// Validate checks that the filter's bounds are consistent
+func (f *VoucherFilter) Validate() error {
+	if f.MinPoints != nil && f.MaxPoints != nil && *f.MinPoints > *f.MaxPoints {
+		return ErrInvalidPointsRange
+	}
+	return f.PageRequest.Validate()
+}
+
+// BrandFilter narrows brand lists. Zero values do not filter.
+type BrandFilter struct {
+	Archived *bool
+	// Search matches part of the brand name
+	Search string
+	PageRequest
+}
+
+// RedemptionFilter narrows a customer's redemption history. From is
+// inclusive and To exclusive; zero values do not filter.
+type RedemptionFilter struct {
+	Status string
+	From   time.Time
+	To     time.Time
+	PageRequest
+}
+
+// Validate checks the status and that the date range is not inverted
+func (f *RedemptionFilter) Validate() error {
+	var errs ValidationErrors
+	if f.Status != "" && !isValidStatus(f.Status) {
+		errs.Add("status", ErrInvalidStatus)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		errs.Add("to", ErrInvalidDateRange)
+	}
+	if err := f.PageRequest.Validate(); err != nil {
+		errs.Add("limit", err)
+	}
+	return errs.Err()
 }
 
 type Customer struct {
@@ -52,6 +293,7 @@ type Customer struct {
 	Name          string    `json:"name"`
 	Email         string    `json:"email"`
 	PointsBalance int       `json:"points_balance"`
+	IsActive      bool      `json:"is_active"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
@@ -60,6 +302,14 @@ func (c *Customer) Validate() error {
 	return validateCustomerInternal(*c)
 }
 
+// Redemption statuses
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusFailed    = "failed"
+)
+
 type Redemption struct {
 	ID              int              `json:"id"`
 	CustomerID      int              `json:"customer_id"`
@@ -74,32 +324,460 @@ func (r *Redemption) Validate() error {
 	return validateRedemptionInternal(*r)
 }
 
+// RedemptionItem is one line of a redemption: Quantity units of a voucher,
+// each costing PointsCost. Codes holds the single-use codes assigned to it,
+// one per unit, when the voucher has a code pool.
 type RedemptionItem struct {
 	ID           int       `json:"id"`
 	RedemptionID int       `json:"redemption_id"`
 	VoucherID    int       `json:"voucher_id"`
+	VoucherName  string    `json:"voucher_name,omitempty"`
+	Quantity     int       `json:"quantity"`
 	PointsCost   int       `json:"points_cost"`
+	Codes        []string  `json:"codes,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// Ledger entry types
+const (
+	LedgerEarn   = "earn"
+	LedgerRedeem = "redeem"
+	LedgerRefund = "refund"
+	LedgerAdjust = "adjust"
+	LedgerExpire = "expire"
+)
+
+// PointsLedgerEntry records a single change to a customer's points balance.
+// Amount is positive for credits and negative for debits.
+type PointsLedgerEntry struct {
+	ID             int       `json:"id"`
+	CustomerID     int       `json:"customer_id"`
+	EntryType      string    `json:"entry_type"`
+	Amount         int       `json:"amount"`
+	BalanceAfter   int       `json:"balance_after"`
+	ReferenceType  string    `json:"reference_type,omitempty"`
+	ReferenceID    string    `json:"reference_id,omitempty"`
+	Description    string    `json:"description,omitempty"`
+	IdempotencyKey string    `json:"idempotency_key,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (e *PointsLedgerEntry) Validate() error {
+	return validateLedgerEntryInternal(*e)
+}
+
+// PointsReconciliation compares a customer's stored balance with the sum of
+// their ledger entries
+type PointsReconciliation struct {
+	CustomerID    int  `json:"customer_id"`
+	Balance       int  `json:"balance"`
+	LedgerBalance int  `json:"ledger_balance"`
+	Difference    int  `json:"difference"`
+	Balanced      bool `json:"balanced"`
+}
+
+// PointsCredit awards points to a customer for an event in an external
+// system such as a purchase at a POS terminal
+type PointsCredit struct {
+	CustomerID        int    `json:"customer_id"`
+	Points            int    `json:"points"`
+	Source            string `json:"source"`
+	ExternalReference string `json:"external_reference"`
+	IdempotencyKey    string `json:"idempotency_key"`
+	Description       string `json:"description"`
+}
+
+func (c *PointsCredit) Validate() error {
+	return validatePointsCreditInternal(*c)
+}
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// idempotency key. StatusCode is zero while the first request carrying the
+// key is still being handled.
+type IdempotencyRecord struct {
+	Scope       string
+	Key         string
+	RequestHash string
+	StatusCode  int
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// API key scopes. Admin grants every other scope.
+const (
+	ScopeAdmin        = "admin"
+	ScopeBrandManager = "brand-manager"
+	ScopeRedeem       = "redeem"
+	ScopeRead         = "read"
+	// ScopeCustomer is held by customers signed in with a token, who may only
+	// act for themselves. API keys cannot be given it.
+	ScopeCustomer = "customer"
+)
+
+// APIKey is a credential a client authenticates with. Only the first few
+// characters of the key itself are kept, as Prefix, so keys can be told
+// apart; the full key is shown once when it is issued. Keys with a TenantID
+// only reach that tenant's brands and their vouchers.
+type APIKey struct {
+	ID        int        `json:"id"`
+	TenantID  *int       `json:"tenant_id,omitempty"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// IssuedAPIKey is a newly created API key together with the key itself
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// PointsCreditResult is the ledger entry a credit produced. Duplicate is set
+// when the idempotency key had already been applied and nothing new was
+// credited.
+type PointsCreditResult struct {
+	Entry     PointsLedgerEntry `json:"entry"`
+	Duplicate bool              `json:"duplicate"`
+}
+
 // Request/Response structures
 type CreateBrandRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// TenantID assigns the brand to a partner. Brands created with a tenant's
+	// own key always belong to that tenant.
+	TenantID *int `json:"tenant_id"`
 }
 
 type CreateVoucherRequest struct {
-	BrandID     int       `json:"brand_id"`
-	Code        string    `json:"code"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	PointsCost  int       `json:"points_cost"`
-	ValidUntil  time.Time `json:"valid_until"`
+	BrandID          int       `json:"brand_id"`
+	Code             string    `json:"code"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	PointsCost       int       `json:"points_cost"`
+	TotalStock       *int      `json:"total_stock"`
+	PerCustomerLimit *int      `json:"per_customer_limit"`
+	LimitPeriod      string    `json:"limit_period"`
+	ValidFrom        time.Time `json:"valid_from"`
+	ValidUntil       time.Time `json:"valid_until"`
+}
+
+// AddVoucherCodesRequest uploads single-use codes to a voucher's pool
+type AddVoucherCodesRequest struct {
+	Codes []string `json:"codes"`
+}
+
+// GenerateVoucherCodesRequest asks for count new codes to be generated into a
+// voucher's pool. Length and alphabet fall back to the generator's defaults.
+type GenerateVoucherCodesRequest struct {
+	Count    int    `json:"count"`
+	Prefix   string `json:"prefix"`
+	Length   int    `json:"length"`
+	Alphabet string `json:"alphabet"`
+}
+
+// VoucherCodePool summarises a voucher's pool after an upload. Codes lists
+// the new codes when they were generated rather than uploaded.
+type VoucherCodePool struct {
+	VoucherID int      `json:"voucher_id"`
+	Added     int      `json:"added"`
+	Available int      `json:"available"`
+	Codes     []string `json:"codes,omitempty"`
+}
+
+// RestockVoucherRequest adds units to a voucher with limited stock
+type RestockVoucherRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+type UpdateBrandRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// BrandArchiveResult reports an archived or restored brand and how many of
+// its vouchers were deactivated or reactivated along with it
+type BrandArchiveResult struct {
+	Brand           *Brand `json:"brand"`
+	VouchersChanged int    `json:"vouchers_changed"`
+}
+
+// UpdateVoucherRequest replaces every editable field of a voucher
+type UpdateVoucherRequest struct {
+	Code             string    `json:"code"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	PointsCost       int       `json:"points_cost"`
+	PerCustomerLimit *int      `json:"per_customer_limit"`
+	LimitPeriod      string    `json:"limit_period"`
+	IsActive         bool      `json:"is_active"`
+	ValidFrom        time.Time `json:"valid_from"`
+	ValidUntil       time.Time `json:"valid_until"`
+}
+
+// PatchVoucherRequest changes only the fields that are present. A null
+// per_customer_limit removes the limit, a null total_stock removes the stock
+// limit, and a null valid_from or valid_until removes that side of the
+// validity window.
+type PatchVoucherRequest struct {
+	Code             *string      `json:"code"`
+	Name             *string      `json:"name"`
+	Description      *string      `json:"description"`
+	PointsCost       *int         `json:"points_cost"`
+	TotalStock       OptionalInt  `json:"total_stock"`
+	PerCustomerLimit OptionalInt  `json:"per_customer_limit"`
+	LimitPeriod      *string      `json:"limit_period"`
+	IsActive         *bool        `json:"is_active"`
+	ValidFrom        OptionalTime `json:"valid_from"`
+	ValidUntil       OptionalTime `json:"valid_until"`
+}
+
+// OptionalInt is a patch field that tells a missing value apart from an
+// explicit null. Set is true when the field was present, and Value is then
+// nil if it was null.
+type OptionalInt struct {
+	Set   bool
+	Value *int
+}
+
+// UnmarshalJSON is only called when the field is present, null included
+func (o *OptionalInt) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	o.Value = nil
+	if string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// OptionalTime is a patch field like OptionalInt. Set is true when the field
+// was present, and Value is then the zero time if it was null.
+type OptionalTime struct {
+	Set   bool
+	Value time.Time
+}
+
+// UnmarshalJSON is only called when the field is present, null included
+func (o *OptionalTime) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	o.Value = time.Time{}
+	if string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// Apply copies the fields present in the patch onto v. Removing the
+// per-customer limit also removes its period unless the patch sets one.
+func (p *PatchVoucherRequest) Apply(v *Voucher) {
+	if p.Code != nil {
+		v.Code = *p.Code
+	}
+	if p.Name != nil {
+		v.Name = *p.Name
+	}
+	if p.Description != nil {
+		v.Description = *p.Description
+	}
+	if p.PointsCost != nil {
+		v.PointsCost = *p.PointsCost
+	}
+	if p.TotalStock.Set {
+		v.TotalStock = p.TotalStock.Value
+	}
+	if p.PerCustomerLimit.Set {
+		v.PerCustomerLimit = p.PerCustomerLimit.Value
+		if v.PerCustomerLimit == nil {
+			v.LimitPeriod = ""
+		}
+	}
+	if p.LimitPeriod != nil {
+		v.LimitPeriod = *p.LimitPeriod
+	}
+	if p.IsActive != nil {
+		v.IsActive = *p.IsActive
+	}
+	if p.ValidFrom.Set {
+		v.ValidFrom = p.ValidFrom.Value
+	}
+	if p.ValidUntil.Set {
+		v.ValidUntil = p.ValidUntil.Value
+	}
+}
+
+type CreateCustomerRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type UpdateCustomerRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	TenantID *int     `json:"tenant_id"`
+}
+
+// Validate checks that the key is named and has only known scopes. Tenant
+// keys are limited to managing and reading their brands.
+func (r *CreateAPIKeyRequest) Validate() error {
+	var errs ValidationErrors
+	if strings.TrimSpace(r.Name) == "" {
+		errs.Add("name", ErrEmptyName)
+	}
+	if len(r.Scopes) == 0 {
+		errs.Add("scopes", ErrNoScopes)
+	}
+	for i, scope := range r.Scopes {
+		field := fmt.Sprintf("scopes[%d]", i)
+		switch scope {
+		case ScopeBrandManager, ScopeRead:
+		case ScopeAdmin, ScopeRedeem:
+			if r.TenantID != nil {
+				errs.Add(field, ErrTenantScope)
+			}
+		default:
+			errs.Add(field, ErrInvalidScope)
+		}
+	}
+	return errs.Err()
+}
+
+// Tenant is a partner that owns brands. Its API keys only see its own brands
+// and their vouchers.
+type Tenant struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks that the tenant is named
+func (t *Tenant) Validate() error {
+	var errs ValidationErrors
+	if strings.TrimSpace(t.Name) == "" {
+		errs.Add("name", ErrEmptyName)
+	}
+	return errs.Err()
+}
+
+type CreateTenantRequest struct {
+	Name string `json:"name"`
 }
 
+type CreditPointsBatchRequest struct {
+	Credits []PointsCredit `json:"credits"`
+}
+
+// Bounds on a redemption request
+const (
+	// MaxItemQuantity bounds how many units of one voucher a redemption may
+	// ask for
+	MaxItemQuantity = 100
+	// MaxBasketItems bounds how many items, or voucher_ids entries, one
+	// redemption request may carry
+	MaxBasketItems = 50
+)
+
+// RedemptionRequest asks to redeem vouchers for a customer. Items is the
+// preferred form; VoucherIDs is kept for older clients and redeems one unit
+// per entry.
 type RedemptionRequest struct {
-	CustomerID int   `json:"customer_id"`
-	VoucherIDs []int `json:"voucher_ids"`
+	CustomerID int              `json:"customer_id"`
+	Items      []RedemptionLine `json:"items"`
+	VoucherIDs []int            `json:"voucher_ids"`
+}
+
+// RedemptionLine asks for Quantity units of one voucher
+type RedemptionLine struct {
+	VoucherID int `json:"voucher_id"`
+	Quantity  int `json:"quantity"`
+}
+
+func (l *RedemptionLine) Validate() error {
+	if l.Quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+	if l.Quantity > MaxItemQuantity {
+		return ErrQuantityTooLarge
+	}
+	return nil
+}
+
+// Validate checks the whole request and returns ValidationErrors listing
+// every problem found
+func (r *RedemptionRequest) Validate() error {
+	var errs ValidationErrors
+	if r.CustomerID <= 0 {
+		errs.Add("customer_id", ErrInvalidCustomerID)
+	}
+
+	switch {
+	case len(r.Items) > 0 && len(r.VoucherIDs) > 0:
+		errs.Add("voucher_ids", ErrMixedItems)
+	case len(r.Items) > 0:
+		if len(r.Items) > MaxBasketItems {
+			errs.Add("items", ErrTooManyItems)
+		}
+		for i := range r.Items {
+			if r.Items[i].VoucherID <= 0 {
+				errs.Add(fmt.Sprintf("items[%d].voucher_id", i), ErrInvalidVoucherID)
+			}
+			if err := r.Items[i].Validate(); err != nil {
+				errs.Add(fmt.Sprintf("items[%d].quantity", i), err)
+			}
+		}
+	case len(r.VoucherIDs) > 0:
+		if len(r.VoucherIDs) > MaxBasketItems {
+			errs.Add("voucher_ids", ErrTooManyItems)
+		}
+		for i, id := range r.VoucherIDs {
+			if id <= 0 {
+				errs.Add(fmt.Sprintf("voucher_ids[%d]", i), ErrInvalidVoucherID)
+			}
+		}
+	default:
+		errs.Add("items", ErrNoItems)
+	}
+
+	// Repeats of a voucher are merged into one line, which must stay within
+	// the same bound as a single item
+	if len(errs) == 0 {
+		for _, line := range r.Lines() {
+			if line.Quantity > MaxItemQuantity {
+				errs.Add("items", fmt.Errorf("voucher %d: %w", line.VoucherID, ErrQuantityTooLarge))
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// Lines returns the requested vouchers with repeats of a voucher merged into
+// one line, in the order each voucher first appears. Each VoucherIDs entry
+// counts as one unit.
+func (r *RedemptionRequest) Lines() []RedemptionLine {
+	requested := r.Items
+	if len(requested) == 0 {
+		for _, id := range r.VoucherIDs {
+			requested = append(requested, RedemptionLine{VoucherID: id, Quantity: 1})
+		}
+	}
+
+	var lines []RedemptionLine
+	index := map[int]int{}
+	for _, line := range requested {
+		if i, ok := index[line.VoucherID]; ok {
+			lines[i].Quantity += line.Quantity
+			continue
+		}
+		index[line.VoucherID] = len(lines)
+		lines = append(lines, line)
+	}
+	return lines
 }
 
 // Validation functions
@@ -110,7 +788,7 @@ func validateBrandInternal(b Brand) error {
 	return nil
 }
 
-func validateVoucherInternal(v Voucher) error {
+func validateVoucherInternal(v Voucher, checkExpiry bool) error {
 	if strings.TrimSpace(v.Code) == "" {
 		return ErrEmptyCode
 	}
@@ -120,9 +798,21 @@ func validateVoucherInternal(v Voucher) error {
 	if v.PointsCost <= 0 {
 		return ErrInvalidPointsCost
 	}
-	if !v.ValidUntil.IsZero() && v.ValidUntil.Before(time.Now()) {
+	if checkExpiry && !v.ValidUntil.IsZero() && v.ValidUntil.Before(time.Now()) {
 		return ErrExpiredVoucher
 	}
+	if !v.ValidFrom.IsZero() && !v.ValidUntil.IsZero() && !v.ValidFrom.Before(v.ValidUntil) {
+		return ErrInvalidValidity
+	}
+	if (v.TotalStock != nil && *v.TotalStock < 0) || (v.RemainingStock != nil && *v.RemainingStock < 0) {
+		return ErrInvalidStock
+	}
+	if v.PerCustomerLimit != nil && *v.PerCustomerLimit <= 0 {
+		return ErrInvalidLimit
+	}
+	if v.LimitPeriod != "" && (v.PerCustomerLimit == nil || !isValidLimitPeriod(v.LimitPeriod)) {
+		return ErrInvalidLimitPeriod
+	}
 	return nil
 }
 
@@ -140,11 +830,46 @@ func validateCustomerInternal(c Customer) error {
 }
 
 func validateRedemptionInternal(r Redemption) error {
+	var errs ValidationErrors
+	if r.CustomerID <= 0 {
+		errs.Add("customer_id", ErrInvalidCustomerID)
+	}
 	if len(r.Items) == 0 {
-		return ErrNoItems
+		errs.Add("items", ErrNoItems)
+	}
+	for i, item := range r.Items {
+		if item.Quantity <= 0 {
+			errs.Add(fmt.Sprintf("items[%d].quantity", i), ErrInvalidQuantity)
+		}
 	}
 	if !isValidStatus(r.Status) {
-		return ErrInvalidStatus
+		errs.Add("status", ErrInvalidStatus)
+	}
+	return errs.Err()
+}
+
+func validateLedgerEntryInternal(e PointsLedgerEntry) error {
+	if !isValidEntryType(e.EntryType) {
+		return ErrInvalidEntryType
+	}
+	if e.Amount == 0 {
+		return ErrZeroAmount
+	}
+	return nil
+}
+
+func validatePointsCreditInternal(c PointsCredit) error {
+	if c.CustomerID <= 0 {
+		return ErrInvalidCustomerID
+	}
+	if c.Points <= 0 {
+		return ErrInvalidPoints
+	}
+	if strings.TrimSpace(c.Source) == "" {
+		return ErrEmptySource
+	}
+	if strings.TrimSpace(c.IdempotencyKey) == "" {
+		return ErrEmptyIdempotencyKey
 	}
 	return nil
 }
@@ -157,10 +882,29 @@ func isValidEmail(email string) bool {
 
 func isValidStatus(status string) bool {
 	validStatuses := map[string]bool{
-		"pending":   true,
-		"completed": true,
-		"cancelled": true,
-		"failed":    true,
+		StatusPending:   true,
+		StatusCompleted: true,
+		StatusCancelled: true,
+		StatusFailed:    true,
 	}
 	return validStatuses[strings.ToLower(status)]
 }
+
+func isValidLimitPeriod(period string) bool {
+	switch period {
+	case PeriodDay, PeriodWeek, PeriodMonth, PeriodYear:
+		return true
+	}
+	return false
+}
+
+func isValidEntryType(entryType string) bool {
+	validTypes := map[string]bool{
+		LedgerEarn:   true,
+		LedgerRedeem: true,
+		LedgerRefund: true,
+		LedgerAdjust: true,
+		LedgerExpire: true,
+	}
+	return validTypes[entryType]
+}
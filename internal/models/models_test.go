@@ -1,6 +1,9 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -162,6 +165,7 @@ func TestRedemption_Validate(t *testing.T) {
 				Items: []RedemptionItem{
 					{
 						VoucherID:  1,
+						Quantity:   1,
 						PointsCost: 100,
 					},
 				},
@@ -204,23 +208,266 @@ func TestRedemption_Validate(t *testing.T) {
 	}
 }
 
+func TestVoucher_CheckRedeemable(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		voucher Voucher
+		wantErr error
+	}{
+		{
+			name:    "open-ended",
+			voucher: Voucher{IsActive: true},
+		},
+		{
+			name:    "within window",
+			voucher: Voucher{IsActive: true, ValidFrom: now.Add(-time.Hour), ValidUntil: now.Add(time.Hour)},
+		},
+		{
+			name:    "inactive",
+			voucher: Voucher{ValidUntil: now.Add(time.Hour)},
+			wantErr: ErrVoucherInactive,
+		},
+		{
+			name:    "not started",
+			voucher: Voucher{IsActive: true, ValidFrom: now.Add(time.Hour)},
+			wantErr: ErrVoucherNotYetValid,
+		},
+		{
+			name:    "expired",
+			voucher: Voucher{IsActive: true, ValidUntil: now.Add(-time.Hour)},
+			wantErr: ErrExpiredVoucher,
+		},
+		{
+			name:    "expires exactly now",
+			voucher: Voucher{IsActive: true, ValidUntil: now},
+			wantErr: ErrExpiredVoucher,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.voucher.CheckRedeemable(now); err != tt.wantErr {
+				t.Errorf("Voucher.CheckRedeemable() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLimitWindowStart(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		period string
+		want   time.Time
+	}{
+		{PeriodDay, time.Date(2024, time.March, 30, 12, 0, 0, 0, time.UTC)},
+		{PeriodWeek, time.Date(2024, time.March, 24, 12, 0, 0, 0, time.UTC)},
+		{PeriodMonth, time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC)},
+		{PeriodYear, time.Date(2023, time.March, 31, 12, 0, 0, 0, time.UTC)},
+		{"", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			if got := LimitWindowStart(tt.period, now); !got.Equal(tt.want) {
+				t.Errorf("LimitWindowStart(%q) = %v, want %v", tt.period, got, tt.want)
+			}
+		})
+	}
+}
+
 // Helper validation functions that would be implemented in models.go
 func validateBrand(b Brand) error {
-	// Add implementation
-	return nil
+	return b.Validate()
 }
 
 func validateVoucher(v Voucher) error {
-	// Add implementation
-	return nil
+	return v.Validate()
 }
 
 func validateCustomer(c Customer) error {
-	// Add implementation
-	return nil
+	return c.Validate()
 }
 
 func validateRedemption(r Redemption) error {
-	// Add implementation
-	return nil
+	return r.Validate()
+}
+
+func TestRedemptionRequest_Lines(t *testing.T) {
+	tests := []struct {
+		name string
+		req  RedemptionRequest
+		want []RedemptionLine
+	}{
+		{
+			name: "repeated items merged",
+			req: RedemptionRequest{Items: []RedemptionLine{
+				{VoucherID: 1, Quantity: 3}, {VoucherID: 2, Quantity: 1}, {VoucherID: 1, Quantity: 1},
+			}},
+			want: []RedemptionLine{{VoucherID: 1, Quantity: 4}, {VoucherID: 2, Quantity: 1}},
+		},
+		{
+			name: "voucher ids grouped in order",
+			req:  RedemptionRequest{VoucherIDs: []int{2, 1, 2}},
+			want: []RedemptionLine{{VoucherID: 2, Quantity: 2}, {VoucherID: 1, Quantity: 1}},
+		},
+		{
+			name: "empty",
+			req:  RedemptionRequest{},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.Lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RedemptionRequest.Lines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchVoucherRequest_Apply(t *testing.T) {
+	limit := func(n int) *int { return &n }
+
+	tests := []struct {
+		name       string
+		body       string
+		wantLimit  *int
+		wantPeriod string
+	}{
+		{
+			name:       "absent limit is kept",
+			body:       `{"name":"Save 10"}`,
+			wantLimit:  limit(2),
+			wantPeriod: PeriodMonth,
+		},
+		{
+			name:       "new limit replaces the old one",
+			body:       `{"per_customer_limit":5}`,
+			wantLimit:  limit(5),
+			wantPeriod: PeriodMonth,
+		},
+		{
+			name:      "null removes the limit and its period",
+			body:      `{"per_customer_limit":null}`,
+			wantLimit: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch PatchVoucherRequest
+			if err := json.Unmarshal([]byte(tt.body), &patch); err != nil {
+				t.Fatalf("decoding patch: %v", err)
+			}
+			v := Voucher{Code: "SAVE10", Name: "Save", PointsCost: 100, PerCustomerLimit: limit(2), LimitPeriod: PeriodMonth}
+			patch.Apply(&v)
+
+			if !reflect.DeepEqual(v.PerCustomerLimit, tt.wantLimit) {
+				t.Errorf("PerCustomerLimit = %v, want %v", v.PerCustomerLimit, tt.wantLimit)
+			}
+			if v.LimitPeriod != tt.wantPeriod {
+				t.Errorf("LimitPeriod = %q, want %q", v.LimitPeriod, tt.wantPeriod)
+			}
+			if err := v.Validate(); err != nil {
+				t.Errorf("patched voucher is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestRedemptionRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        RedemptionRequest
+		wantFields []string
+	}{
+		{
+			name: "valid items",
+			req:  RedemptionRequest{CustomerID: 1, Items: []RedemptionLine{{VoucherID: 1, Quantity: 2}}},
+		},
+		{
+			name: "valid voucher ids",
+			req:  RedemptionRequest{CustomerID: 1, VoucherIDs: []int{1, 1}},
+		},
+		{
+			name:       "every problem reported",
+			req:        RedemptionRequest{Items: []RedemptionLine{{VoucherID: 0, Quantity: 0}}},
+			wantFields: []string{"customer_id", "items[0].voucher_id", "items[0].quantity"},
+		},
+		{
+			name:       "empty basket",
+			req:        RedemptionRequest{CustomerID: 1},
+			wantFields: []string{"items"},
+		},
+		{
+			name:       "both forms",
+			req:        RedemptionRequest{CustomerID: 1, Items: []RedemptionLine{{VoucherID: 1, Quantity: 1}}, VoucherIDs: []int{1}},
+			wantFields: []string{"voucher_ids"},
+		},
+		{
+			name:       "too many items",
+			req:        RedemptionRequest{CustomerID: 1, VoucherIDs: make([]int, MaxBasketItems+1)},
+			wantFields: []string{"voucher_ids", "voucher_ids[0]"},
+		},
+		{
+			name: "merged quantity above the bound",
+			req: RedemptionRequest{CustomerID: 1, Items: []RedemptionLine{
+				{VoucherID: 1, Quantity: MaxItemQuantity}, {VoucherID: 1, Quantity: 1},
+			}},
+			wantFields: []string{"items"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Errorf("RedemptionRequest.Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("RedemptionRequest.Validate() error = %v, want ValidationErrors", err)
+			}
+			var fields []string
+			for _, fe := range errs {
+				fields = append(fields, fe.Field)
+			}
+			// Only the first few fields are compared; a basket of zero ids
+			// reports every entry
+			if len(fields) > len(tt.wantFields) {
+				fields = fields[:len(tt.wantFields)]
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("RedemptionRequest.Validate() fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestValidationErrors_Is(t *testing.T) {
+	var errs ValidationErrors
+	errs.Add("customer_id", ErrInvalidCustomerID)
+	errs.Add("items", ErrNoItems)
+
+	err := errs.Err()
+	if !errors.Is(err, ErrNoItems) || !errors.Is(err, ErrInvalidCustomerID) {
+		t.Errorf("errors.Is did not match the collected errors in %v", err)
+	}
+	if errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("errors.Is matched an error that was not collected")
+	}
+	if want := "customer_id: customer id must be positive; items: redemption must have at least one item"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if (ValidationErrors{}).Err() != nil {
+		t.Errorf("empty ValidationErrors should give a nil error")
+	}
 }
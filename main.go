@@ -5,11 +5,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
+	"voucher-api/internal/auth"
 	"voucher-api/internal/database"
 	"voucher-api/internal/handlers"
+	"voucher-api/internal/models"
 
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
 )
 
@@ -28,21 +31,127 @@ func main() {
 
 	// Initialize handlers
 	h := handlers.NewHandler(db)
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid IDEMPOTENCY_TTL: %v", err)
+		}
+		h.SetIdempotencyTTL(ttl)
+	}
+	// Lets the first API keys be issued; remove it once they have been
+	if key := os.Getenv("ADMIN_API_KEY"); key != "" {
+		h.SetBootstrapKey(key)
+	}
+
+	// Customer tokens from the consumer app, signed with a shared secret
+	// (HS256) or a key published in a JWKS file (RS256)
+	tokens := auth.NewTokenVerifier(os.Getenv("JWT_ISSUER"), os.Getenv("JWT_AUDIENCE"))
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		tokens.SetSecret([]byte(secret))
+	}
+	if path := os.Getenv("JWT_JWKS_FILE"); path != "" {
+		if err := tokens.LoadJWKS(path); err != nil {
+			log.Fatalf("Failed to load JWT_JWKS_FILE: %v", err)
+		}
+	}
+	h.SetTokenVerifier(tokens)
+
+	// Keys that belong to a tenant only see that tenant's brands and vouchers
+	h.SetTenantScope(func(tenantID int) handlers.Database {
+		return db.ForTenant(tenantID)
+	})
+
+	// Drop stored idempotent responses once they can no longer be replayed
+	go func() {
+		for range time.Tick(time.Hour) {
+			if _, err := db.PurgeExpiredIdempotencyKeys(); err != nil {
+				log.Printf("Failed to purge idempotency keys: %v", err)
+			}
+		}
+	}()
 
 	// Create router
 	r := chi.NewRouter()
 
 	// Middleware
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(h.Authenticate)
+	r.NotFound(handlers.NotFound)
+	r.MethodNotAllowed(handlers.MethodNotAllowed)
+
+	// Scopes each route needs; admin keys pass all of them. Customers signed in
+	// with a token can only create redemptions, for themselves. Tenant keys
+	// are kept to brands and vouchers by platform.
+	read := h.RequireScope(models.ScopeRead)
+	manage := h.RequireScope(models.ScopeBrandManager)
+	redeem := h.RequireScope(models.ScopeRedeem)
+	redeemOwn := h.RequireScope(models.ScopeRedeem, models.ScopeCustomer)
+	admin := h.RequireScope(models.ScopeAdmin)
+	platform := h.RequirePlatform
 
 	// Routes
-	r.Post("/brand", h.CreateBrand)
-	r.Post("/voucher", h.CreateVoucher)
-	r.Get("/voucher", h.GetVoucher)
-	r.Get("/voucher/brand", h.GetVouchersByBrand)
-	r.Post("/transaction/redemption", h.CreateRedemption)
-	r.Get("/transaction/redemption", h.GetRedemption)
+	r.Route("/brands", func(r chi.Router) {
+		r.With(read).Get("/", h.ListBrands)
+		r.With(manage, h.Idempotent).Post("/", h.CreateBrand)
+		r.With(read).Get("/{id}", h.GetBrand)
+		r.With(manage).Put("/{id}", h.UpdateBrand)
+		r.With(manage).Post("/{id}/archive", h.ArchiveBrand)
+		r.With(manage).Post("/{id}/restore", h.RestoreBrand)
+		r.With(read).Get("/{id}/vouchers", h.GetVouchersByBrand)
+	})
+
+	r.Route("/vouchers", func(r chi.Router) {
+		r.With(read).Get("/", h.ListVouchers)
+		r.With(manage, h.Idempotent).Post("/", h.CreateVoucher)
+		r.With(read).Get("/{id}", h.GetVoucher)
+		r.With(manage).Put("/{id}", h.UpdateVoucher)
+		r.With(manage).Patch("/{id}", h.PatchVoucher)
+		r.With(manage).Delete("/{id}", h.DeleteVoucher)
+		r.With(manage).Post("/{id}/activate", h.ActivateVoucher)
+		r.With(manage).Post("/{id}/deactivate", h.DeactivateVoucher)
+		r.With(manage).Post("/{id}/restock", h.RestockVoucher)
+		r.With(manage).Post("/{id}/codes", h.AddVoucherCodes)
+		r.With(manage).Post("/{id}/codes/generate", h.GenerateVoucherCodes)
+	})
+
+	r.Route("/customers", func(r chi.Router) {
+		r.Use(platform)
+		r.With(read).Get("/", h.ListCustomers)
+		r.With(admin).Post("/", h.CreateCustomer)
+		r.With(read).Get("/{id}", h.GetCustomer)
+		r.With(admin).Put("/{id}", h.UpdateCustomer)
+		r.With(admin).Delete("/{id}", h.DeactivateCustomer)
+		r.With(read).Get("/{id}/redemptions", h.ListCustomerRedemptions)
+		r.With(admin).Post("/{id}/points", h.CreditCustomerPoints)
+		r.With(read).Get("/{id}/ledger", h.GetCustomerLedger)
+		r.With(read).Get("/{id}/ledger/reconciliation", h.ReconcileCustomerPoints)
+	})
+
+	r.Route("/redemptions", func(r chi.Router) {
+		r.Use(platform)
+		r.With(redeemOwn, h.Idempotent).Post("/", h.CreateRedemption)
+		r.With(read).Get("/{id}", h.GetRedemption)
+		r.With(redeem).Post("/{id}/complete", h.CompleteRedemption)
+		r.With(redeem).Post("/{id}/cancel", h.CancelRedemption)
+		r.With(redeem).Post("/{id}/fail", h.FailRedemption)
+	})
+
+	r.With(platform, admin).Post("/points/credits", h.CreditPointsBatch)
+
+	r.Route("/api-keys", func(r chi.Router) {
+		r.Use(platform, admin)
+		r.Get("/", h.ListAPIKeys)
+		r.Post("/", h.CreateAPIKey)
+		r.Delete("/{id}", h.RevokeAPIKey)
+	})
+
+	r.Route("/tenants", func(r chi.Router) {
+		r.Use(platform, admin)
+		r.Get("/", h.ListTenants)
+		r.Post("/", h.CreateTenant)
+	})
 
 	// Start server
 	port := os.Getenv("SERVER_PORT")
@@ -0,0 +1,20 @@
+CREATE TABLE points_ledger (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    customer_id INT NOT NULL,
+    entry_type VARCHAR(20) NOT NULL,
+    amount INT NOT NULL,
+    balance_after INT NOT NULL,
+    reference_type VARCHAR(50) NOT NULL DEFAULT '',
+    reference_id VARCHAR(255) NOT NULL DEFAULT '',
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
+
+CREATE INDEX idx_points_ledger_customer_id ON points_ledger(customer_id);
+
+-- Seed the ledger with existing balances so it reconciles from day one
+INSERT INTO points_ledger (customer_id, entry_type, amount, balance_after, description)
+SELECT id, 'adjust', points_balance, points_balance, 'Opening balance'
+FROM customers
+WHERE points_balance <> 0;
@@ -0,0 +1,2 @@
+ALTER TABLE customers MODIFY updated_at DATETIME NULL;
+ALTER TABLE customers DROP COLUMN is_active;
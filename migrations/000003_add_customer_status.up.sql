@@ -0,0 +1,5 @@
+ALTER TABLE customers ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT true AFTER points_balance;
+
+-- updated_at was never populated and cannot be scanned while NULL
+UPDATE customers SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE customers MODIFY updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
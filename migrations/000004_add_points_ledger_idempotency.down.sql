@@ -0,0 +1,3 @@
+DROP INDEX idx_points_ledger_idempotency_key ON points_ledger;
+
+ALTER TABLE points_ledger DROP COLUMN idempotency_key;
@@ -0,0 +1,3 @@
+ALTER TABLE points_ledger ADD COLUMN idempotency_key VARCHAR(255) NULL AFTER description;
+
+CREATE UNIQUE INDEX idx_points_ledger_idempotency_key ON points_ledger(idempotency_key);
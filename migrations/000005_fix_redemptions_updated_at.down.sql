@@ -0,0 +1 @@
+ALTER TABLE redemptions MODIFY updated_at DATETIME NULL;
@@ -0,0 +1,3 @@
+-- Redemptions now change status after creation; keep updated_at populated
+UPDATE redemptions SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE redemptions MODIFY updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
@@ -0,0 +1,2 @@
+ALTER TABLE vouchers MODIFY updated_at DATETIME NULL;
+ALTER TABLE vouchers DROP COLUMN deleted_at;
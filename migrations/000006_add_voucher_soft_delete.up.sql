@@ -0,0 +1,6 @@
+-- Deleted vouchers are kept so redemption history can still reference them
+ALTER TABLE vouchers ADD COLUMN deleted_at DATETIME NULL AFTER valid_until;
+
+-- Vouchers can now be edited; keep updated_at populated
+UPDATE vouchers SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE vouchers MODIFY updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
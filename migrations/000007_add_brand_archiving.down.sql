@@ -0,0 +1,3 @@
+ALTER TABLE brands MODIFY updated_at DATETIME NULL;
+ALTER TABLE vouchers DROP COLUMN archived_with_brand;
+ALTER TABLE brands DROP COLUMN archived_at;
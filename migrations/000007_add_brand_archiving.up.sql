@@ -0,0 +1,9 @@
+ALTER TABLE brands ADD COLUMN archived_at DATETIME NULL AFTER description;
+
+-- Set on vouchers deactivated by archiving their brand, so restoring the brand
+-- reactivates exactly those and leaves vouchers that were already off alone
+ALTER TABLE vouchers ADD COLUMN archived_with_brand BOOLEAN NOT NULL DEFAULT false AFTER is_active;
+
+-- Brands can now be edited; keep updated_at populated
+UPDATE brands SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE brands MODIFY updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
@@ -0,0 +1,2 @@
+DROP INDEX idx_vouchers_valid_until ON vouchers;
+ALTER TABLE vouchers DROP COLUMN valid_from;
@@ -0,0 +1,7 @@
+ALTER TABLE vouchers ADD COLUMN valid_from DATETIME NULL AFTER archived_with_brand;
+
+-- Vouchers created without an expiry were stored with a zero date; NULL now
+-- means the voucher never expires
+UPDATE vouchers SET valid_until = NULL WHERE valid_until < '1000-01-01';
+
+CREATE INDEX idx_vouchers_valid_until ON vouchers(valid_until);
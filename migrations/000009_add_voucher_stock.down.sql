@@ -0,0 +1,3 @@
+ALTER TABLE vouchers DROP CHECK chk_vouchers_remaining_stock;
+ALTER TABLE vouchers DROP COLUMN remaining_stock;
+ALTER TABLE vouchers DROP COLUMN total_stock;
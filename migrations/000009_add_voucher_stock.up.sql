@@ -0,0 +1,4 @@
+-- NULL stock means the voucher can be redeemed any number of times
+ALTER TABLE vouchers ADD COLUMN total_stock INT NULL AFTER points_cost;
+ALTER TABLE vouchers ADD COLUMN remaining_stock INT NULL AFTER total_stock;
+ALTER TABLE vouchers ADD CONSTRAINT chk_vouchers_remaining_stock CHECK (remaining_stock >= 0);
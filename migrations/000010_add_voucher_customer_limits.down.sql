@@ -0,0 +1,2 @@
+ALTER TABLE vouchers DROP COLUMN limit_period;
+ALTER TABLE vouchers DROP COLUMN per_customer_limit;
@@ -0,0 +1,4 @@
+-- NULL per_customer_limit means no limit; NULL limit_period means the limit
+-- applies over the customer's whole history
+ALTER TABLE vouchers ADD COLUMN per_customer_limit INT NULL AFTER remaining_stock;
+ALTER TABLE vouchers ADD COLUMN limit_period VARCHAR(10) NULL AFTER per_customer_limit;
@@ -0,0 +1,2 @@
+DROP TABLE voucher_codes;
+ALTER TABLE vouchers DROP COLUMN code_pool;
@@ -0,0 +1,17 @@
+-- Set once a pool of single-use codes has been uploaded for a voucher; every
+-- unit redeemed from then on must be given one of the pool's codes
+ALTER TABLE vouchers ADD COLUMN code_pool BOOLEAN NOT NULL DEFAULT false AFTER limit_period;
+
+CREATE TABLE voucher_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    voucher_id INT NOT NULL,
+    code VARCHAR(100) NOT NULL UNIQUE,
+    redemption_item_id INT NULL,
+    assigned_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (voucher_id) REFERENCES vouchers(id),
+    FOREIGN KEY (redemption_item_id) REFERENCES redemption_items(id)
+);
+
+-- Finding the next unused code of a voucher
+CREATE INDEX idx_voucher_codes_unused ON voucher_codes(voucher_id, redemption_item_id);
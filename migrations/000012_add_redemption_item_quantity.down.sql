@@ -0,0 +1,2 @@
+ALTER TABLE redemption_items DROP CHECK chk_redemption_items_quantity;
+ALTER TABLE redemption_items DROP COLUMN quantity;
@@ -0,0 +1,4 @@
+-- Each item is one line of a redemption; points_cost stays the cost of a
+-- single unit at the time of redemption
+ALTER TABLE redemption_items ADD COLUMN quantity INT NOT NULL DEFAULT 1 AFTER voucher_id;
+ALTER TABLE redemption_items ADD CONSTRAINT chk_redemption_items_quantity CHECK (quantity > 0);
@@ -0,0 +1,3 @@
+-- The foreign key needs an index on customer_id, so add one back before
+-- dropping ours
+ALTER TABLE redemptions ADD INDEX customer_id (customer_id), DROP INDEX idx_redemptions_customer_id;
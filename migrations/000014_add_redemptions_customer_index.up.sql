@@ -0,0 +1,4 @@
+-- Customer redemption history filters by customer and creation date. This
+-- index also serves the customer_id foreign key, so MySQL drops the one it
+-- created implicitly for it.
+CREATE INDEX idx_redemptions_customer_id ON redemptions(customer_id, created_at);
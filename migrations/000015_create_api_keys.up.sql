@@ -0,0 +1,12 @@
+-- Credentials for API clients. Only a SHA-256 hash of each key is stored;
+-- key_prefix keeps the first characters so keys can be told apart. scopes is
+-- a comma-separated list.
+CREATE TABLE api_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(20) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    scopes VARCHAR(255) NOT NULL,
+    revoked_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
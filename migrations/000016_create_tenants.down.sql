@@ -0,0 +1,3 @@
+ALTER TABLE api_keys DROP FOREIGN KEY fk_api_keys_tenant, DROP COLUMN tenant_id;
+ALTER TABLE brands DROP FOREIGN KEY fk_brands_tenant, DROP COLUMN tenant_id;
+DROP TABLE tenants;
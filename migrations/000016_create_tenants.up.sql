@@ -0,0 +1,14 @@
+-- Brand partners. A brand with a tenant is only visible to that tenant's API
+-- keys; brands without one belong to the platform. Keys without a tenant see
+-- every brand.
+CREATE TABLE tenants (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE brands ADD COLUMN tenant_id INT NULL AFTER id,
+    ADD CONSTRAINT fk_brands_tenant FOREIGN KEY (tenant_id) REFERENCES tenants(id);
+
+ALTER TABLE api_keys ADD COLUMN tenant_id INT NULL AFTER id,
+    ADD CONSTRAINT fk_api_keys_tenant FOREIGN KEY (tenant_id) REFERENCES tenants(id);
@@ -0,0 +1,12 @@
+-- Every code a customer can be handed, voucher codes and pool codes alike.
+-- Its primary key is what keeps the two kinds from sharing a code: a code is
+-- claimed here in the same transaction that stores it. Codes stay reserved
+-- when their voucher is deleted.
+CREATE TABLE reserved_codes (
+    code VARCHAR(100) PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A code already shared by a voucher and a pool keeps a single row
+INSERT IGNORE INTO reserved_codes (code) SELECT code FROM vouchers;
+INSERT IGNORE INTO reserved_codes (code) SELECT code FROM voucher_codes;